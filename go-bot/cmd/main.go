@@ -2,18 +2,24 @@ package main
 
 import (
 	"context"
+	"io"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/drew/omnik-bot/internal/bot"
+	"github.com/drew/omnik-bot/internal/version"
 	_ "github.com/joho/godotenv/autoload"
 )
 
+// shutdownTimeout is how long running queries get to stop on shutdown
+const shutdownTimeout = 15 * time.Second
+
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
-	log.Println("🚀 Starting omnik Go bot...")
+	log.Printf("🚀 Starting omnik Go bot %s...", version.String())
 
 	// Load configuration
 	cfg, err := bot.LoadConfigFromEnv()
@@ -21,6 +27,16 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Mirror the log to a file so /log can tail it
+	if cfg.LogFile != "" {
+		logFile, err := os.OpenFile(cfg.LogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			log.Fatalf("Failed to open log file: %v", err)
+		}
+		defer logFile.Close()
+		log.SetOutput(io.MultiWriter(os.Stderr, logFile))
+	}
+
 	// Create bot
 	b, err := bot.New(cfg)
 	if err != nil {
@@ -31,13 +47,19 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Handle shutdown signals
+	// Handle shutdown signals: stop running queries, give them time to
+	// wind down, then stop the bot
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
 	go func() {
 		<-sigChan
 		log.Println("Received shutdown signal, stopping bot...")
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancelShutdown()
+		if err := b.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Warning: %v", err)
+		}
 		cancel()
 	}()
 
@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry represents a single audit record
+type Entry struct {
+	Time    time.Time `json:"time"`
+	UserID  int64     `json:"user_id"`
+	ChatID  int64     `json:"chat_id"`
+	Kind    string    `json:"kind"` // message, command, callback
+	Input   string    `json:"input"`
+	Outcome string    `json:"outcome"`
+}
+
+// Logger appends audit entries as JSON lines to a file
+type Logger struct {
+	file *os.File
+	mu   sync.Mutex
+}
+
+// NewLogger opens (or creates) the audit log at path in append-only mode
+func NewLogger(path string) (*Logger, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	return &Logger{file: file}, nil
+}
+
+// Log writes an entry to the audit log. A nil Logger is a no-op.
+func (l *Logger) Log(entry Entry) error {
+	if l == nil {
+		return nil
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return fmt.Errorf("audit log is closed")
+	}
+
+	// A single write per entry keeps lines intact under O_APPEND
+	if _, err := l.file.Write(data); err != nil {
+		return fmt.Errorf("failed to write audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// Close flushes the audit log to disk and closes it
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	syncErr := l.file.Sync()
+	closeErr := l.file.Close()
+	l.file = nil
+
+	if syncErr != nil {
+		return fmt.Errorf("failed to sync audit log: %w", syncErr)
+	}
+	return closeErr
+}
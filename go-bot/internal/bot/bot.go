@@ -3,35 +3,137 @@ package bot
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 
+	"github.com/drew/omnik-bot/internal/audit"
 	"github.com/drew/omnik-bot/internal/claude"
+	"github.com/drew/omnik-bot/internal/schedule"
 	"github.com/drew/omnik-bot/internal/session"
+	"github.com/drew/omnik-bot/internal/version"
 )
 
 // Bot represents the Telegram bot
 type Bot struct {
 	api            *tgbotapi.BotAPI
-	claudeClient   claude.QueryClient // Interface for both HTTP and SDK clients
+	claudeClient   claude.QueryClient // CLI or HTTP bridge client
 	sessionManager *session.Manager
-	authorizedUID  int64
-	workingDir     string // Current working directory for debugging
+	schedules      *schedule.Store
+	authorizedUIDs map[int64]bool    // Users allowed to use the bot
+	adminUID       int64             // First authorized user; runs admin commands
+	workingDir     string            // Working directory when there is no session
+	auditLog       *audit.Logger     // Nil when audit logging is disabled
+	querySem       chan struct{}     // Limits concurrent Claude queries (nil = unlimited)
+	fileThreshold  int               // Response characters above which a file is sent (0 = never)
+	fileBytes      int               // Response bytes above which a file is sent (0 = never)
+	aliases        map[string]string // Command alias -> canonical command
+	execAllowlist  []string          // Binaries /exec may run (empty = any)
+	execDenylist   []string          // Command prefixes /exec refuses
+	workspaceRoot  string            // File commands are confined to this directory
+	showTimings    bool              // Append a timing footer to responses
+	sendImages     bool              // Send images Claude writes as photos
+	maxPromptChars int               // Longest prompt accepted (0 = unlimited)
+	mu             sync.RWMutex      // Protects claudeModel
+
+	pendingConfirms map[string]pendingConfirm // Inline confirmations by ID
+	confirmSeq      int
+	confirmMu       sync.Mutex
+
+	health   healthStatus // Last known Claude health
+	healthMu sync.RWMutex
+
+	stopChannels  map[int64]*runningQuery  // Running query per chat
+	runningExecs  map[int64]*runningQuery  // Running /exec command per chat
+	queuedPrompts map[int64][]queuedPrompt // Prompts waiting per chat
+	queueDepth    int                      // Max queued prompts per chat
+	shuttingDown  bool                     // Set by Shutdown; no new queries start
+	stopMutex     sync.Mutex
+
+	queryWG sync.WaitGroup // Queries registered by registerQuery, drained by Shutdown
+
+	profiles     map[string]Profile // Available profiles by name
+	chatProfiles map[int64]string   // Active profile per chat
+	chatModels   map[int64]string   // Model chosen with /model per chat
+	chatSessions map[int64]string   // Session chosen per chat, by name
+	chatDirs     map[int64]string   // Working directory per chat
+	chatMu       sync.RWMutex       // Protects the per-chat maps above
+
+	logFile          string        // Log file tailed by /log ("" = stdout only)
+	queryRetries     int           // Retries for queries failing before any output
+	claudeTimeout    time.Duration // Longest a query may run (0 = no limit)
+	execTimeout      time.Duration // Longest an /exec command may run (0 = no limit)
+	autoReloadBytes  int64         // Transcript size that triggers a fresh conversation (0 = never)
+	downloadMaxBytes int64         // Largest file /download saves
+
+	messages catalog // User-facing strings in the configured language
+
+	pendingPerms map[string]pendingPermission // Tool permission prompts by ID
+	permSeq      int
+	permMu       sync.Mutex
+
+	claudeModel      string  // Default model; changed by /setdefaultmodel
+	confirmExpensive bool    // Confirm large prompts on expensive models
+	confirmCostUSD   float64 // Estimated cost that triggers the confirmation
+
+	configFile string // OMNI_CONFIG_FILE, rewritten by /setdefaultmodel
+
+	observerChatID int64 // Read-only chat mirroring completed queries (0 = none)
+
+	transcriber Transcriber // Speech-to-text for voice messages (nil = disabled)
 }
 
 // Config holds bot configuration
 type Config struct {
-	TelegramToken   string
-	AuthorizedUID   int64
-	ClaudeBridgeURL string // For HTTP mode (legacy)
-	UseSDK          bool   // Use SDK client instead of HTTP
-	ClaudeModel     string // Model to use (sonnet, opus, etc)
+	TelegramToken    string
+	AuthorizedUIDs   []int64           // Allowed users; the first is the admin
+	ClaudeBridgeURL  string            // For HTTP mode (legacy)
+	ClaudeClient     string            // "cli" runs the claude binary, "http" calls the bridge
+	ClaudeModel      string            // Model to use (sonnet, opus, etc)
+	AuditLogPath     string            // Append-only audit log file (empty disables)
+	MaxQueries       int               // Max concurrent Claude queries (0 = unlimited)
+	FileThreshold    int               // Send responses longer than this many characters as a file (0 = never)
+	FileBytes        int               // Send responses larger than this many bytes as a file (0 = never)
+	CommandAliases   map[string]string // Alias -> canonical command name
+	ExecAllowlist    []string          // Binaries /exec may run (empty = any)
+	ExecDenylist     []string          // Command prefixes /exec refuses
+	WorkspaceRoot    string            // Directory file commands are confined to
+	ShowTimings      bool              // Append duration/tool calls/tokens to responses
+	SendImages       bool              // Send images Claude writes as photos after the response
+	MaxPromptChars   int               // Longest prompt accepted (0 = unlimited)
+	ProfilesFile     string            // JSON file with extra query profiles
+	LogFile          string            // File the bot's log is also written to
+	QueryRetries     int               // Retries for queries failing before any output
+	ClaudeTimeout    time.Duration     // Longest a query may run (0 = no limit)
+	ExecTimeout      time.Duration     // Longest an /exec command may run (0 = no limit)
+	AutoReloadMB     int               // Transcript size that triggers a fresh conversation (0 = never)
+	DownloadMaxMB    int               // Largest file /download saves
+	Lang             string            // Language of bot messages
+	MaxLineSize      int               // Longest CLI output line in bytes (0 = default)
+	ConfirmExpensive bool              // Confirm large prompts on expensive models
+	ConfirmCostUSD   float64           // Estimated cost that triggers the confirmation
+	ConfigFile       string            // JSON config file the settings were read from
+	ObserverChatID   int64             // Chat receiving a copy of each completed query
+	QueueDepth       int               // Prompts queued per chat behind a running query
+	STTURL           string            // Transcription endpoint for voice messages
+	STTAPIKey        string            // Bearer token for the transcription endpoint
+	STTModel         string            // Model name sent to the transcription endpoint
+	STTCommand       string            // Local transcription command, used without STTURL
+
+	DefaultSessionName string // Name of the session created on first run
+	DefaultSessionDir  string // Working directory of the first-run session
 }
 
 // New creates a new bot instance
@@ -45,22 +147,18 @@ func New(cfg Config) (*Bot, error) {
 
 	// Create appropriate Claude client
 	var claudeClient claude.QueryClient
-	if cfg.UseSDK {
+	if cfg.ClaudeClient == "cli" {
 		log.Printf("Using Claude CLI client (model: %s)", cfg.ClaudeModel)
-		claudeClient = claude.NewCLIClient(cfg.ClaudeModel, "bypassPermissions")
+		cliClient := claude.NewCLIClient(cfg.ClaudeModel, "bypassPermissions")
+		if cfg.MaxLineSize > 0 {
+			cliClient.SetMaxLineSize(cfg.MaxLineSize)
+		}
+		claudeClient = cliClient
 	} else {
 		log.Printf("Using Claude HTTP client (bridge: %s)", cfg.ClaudeBridgeURL)
 		claudeClient = claude.NewClient(cfg.ClaudeBridgeURL)
 	}
 
-	// Check Claude health
-	ctx := context.Background()
-	if err := claudeClient.Health(ctx); err != nil {
-		log.Printf("WARNING: Claude health check failed: %v", err)
-	} else {
-		log.Printf("✓ Claude is healthy")
-	}
-
 	// Initialize session manager
 	sessionManager, err := session.NewManager("/workspace/.omnik-sessions.json")
 	if err != nil {
@@ -69,35 +167,142 @@ func New(cfg Config) (*Bot, error) {
 
 	// Create default session if none exists
 	if len(sessionManager.List()) == 0 {
-		_, err := sessionManager.Create("default", "Default session", "/workspace")
+		if err := os.MkdirAll(cfg.DefaultSessionDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create default session directory: %w", err)
+		}
+		_, err := sessionManager.Create(cfg.DefaultSessionName, "Default session", cfg.DefaultSessionDir)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create default session: %w", err)
 		}
-		log.Printf("Created default session")
+		log.Printf("Created default session %s in %s", cfg.DefaultSessionName, cfg.DefaultSessionDir)
+	}
+
+	// Initialize scheduled jobs
+	schedules, err := schedule.NewStore("/workspace/.omnik-schedules.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schedule store: %w", err)
+	}
+
+	// Load the message catalog
+	messages, err := loadCatalog(cfg.Lang)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load query profiles
+	profiles, err := loadProfiles(cfg.ProfilesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Restore each chat's profile, model, session and working directory
+	chatStates, err := loadChatState(chatStatePath)
+	if err != nil {
+		return nil, err
+	}
+	chatProfiles := make(map[int64]string)
+	chatModels := make(map[int64]string)
+	chatSessions := make(map[int64]string)
+	chatDirs := make(map[int64]string)
+	for chatID, state := range chatStates {
+		if state.Profile != "" {
+			chatProfiles[chatID] = state.Profile
+		}
+		if state.Model != "" {
+			chatModels[chatID] = state.Model
+		}
+		if state.Session != "" {
+			chatSessions[chatID] = state.Session
+		}
+		if state.WorkingDir != "" {
+			chatDirs[chatID] = state.WorkingDir
+		}
+	}
+
+	// Open audit log if configured
+	var auditLog *audit.Logger
+	if cfg.AuditLogPath != "" {
+		auditLog, err = audit.NewLogger(cfg.AuditLogPath)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Audit logging to %s", cfg.AuditLogPath)
+	}
+
+	authorizedUIDs := make(map[int64]bool, len(cfg.AuthorizedUIDs))
+	for _, uid := range cfg.AuthorizedUIDs {
+		authorizedUIDs[uid] = true
 	}
 
-	// Get current session's working directory
-	currentSession := sessionManager.Current()
-	workingDir := "/workspace"
-	if currentSession != nil {
-		workingDir = currentSession.WorkingDir
+	// Limit concurrent Claude processes
+	var querySem chan struct{}
+	if cfg.MaxQueries > 0 {
+		querySem = make(chan struct{}, cfg.MaxQueries)
 	}
 
-	return &Bot{
+	b := &Bot{
 		api:            api,
 		claudeClient:   claudeClient,
 		sessionManager: sessionManager,
-		authorizedUID:  cfg.AuthorizedUID,
-		workingDir:     workingDir,
-	}, nil
+		schedules:      schedules,
+		authorizedUIDs: authorizedUIDs,
+		adminUID:       cfg.AuthorizedUIDs[0],
+		workingDir:     cfg.DefaultSessionDir,
+		auditLog:       auditLog,
+		querySem:       querySem,
+		fileThreshold:  cfg.FileThreshold,
+		fileBytes:      cfg.FileBytes,
+		aliases:        cfg.CommandAliases,
+		execAllowlist:  cfg.ExecAllowlist,
+		execDenylist:   cfg.ExecDenylist,
+		workspaceRoot:  cfg.WorkspaceRoot,
+		showTimings:    cfg.ShowTimings,
+		sendImages:     cfg.SendImages,
+		maxPromptChars: cfg.MaxPromptChars,
+
+		pendingConfirms:  make(map[string]pendingConfirm),
+		stopChannels:     make(map[int64]*runningQuery),
+		runningExecs:     make(map[int64]*runningQuery),
+		queuedPrompts:    make(map[int64][]queuedPrompt),
+		queueDepth:       cfg.QueueDepth,
+		profiles:         profiles,
+		logFile:          cfg.LogFile,
+		queryRetries:     cfg.QueryRetries,
+		claudeTimeout:    cfg.ClaudeTimeout,
+		execTimeout:      cfg.ExecTimeout,
+		autoReloadBytes:  int64(cfg.AutoReloadMB) * 1024 * 1024,
+		downloadMaxBytes: int64(cfg.DownloadMaxMB) * 1024 * 1024,
+		messages:         messages,
+		pendingPerms:     make(map[string]pendingPermission),
+		claudeModel:      cfg.ClaudeModel,
+		confirmExpensive: cfg.ConfirmExpensive,
+		confirmCostUSD:   cfg.ConfirmCostUSD,
+		configFile:       cfg.ConfigFile,
+		chatProfiles:     chatProfiles,
+		chatModels:       chatModels,
+		chatSessions:     chatSessions,
+		chatDirs:         chatDirs,
+		observerChatID:   cfg.ObserverChatID,
+		transcriber:      newTranscriber(cfg),
+	}
+
+	// Check Claude health
+	b.checkHealth(context.Background())
+
+	return b, nil
 }
 
 // Start starts the bot
 func (b *Bot) Start(ctx context.Context) error {
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+	defer b.auditLog.Close()
 
-	updates := b.api.GetUpdatesChan(u)
+	go b.healthLoop(ctx)
+	go b.schedulerLoop(ctx)
+	go b.registerCommands()
+
+	poller := newUpdatePoller(b.api)
+	go poller.run(ctx)
+	updates := poller.updates
 
 	log.Println("🤖 Bot started, waiting for messages...")
 
@@ -106,6 +311,11 @@ func (b *Bot) Start(ctx context.Context) error {
 		case <-ctx.Done():
 			return ctx.Err()
 		case update := <-updates:
+			if update.CallbackQuery != nil {
+				b.handleCallbackQuery(ctx, update.CallbackQuery)
+				continue
+			}
+
 			if update.Message == nil {
 				continue
 			}
@@ -117,13 +327,20 @@ func (b *Bot) Start(ctx context.Context) error {
 
 // handleMessage processes incoming messages
 func (b *Bot) handleMessage(ctx context.Context, msg *tgbotapi.Message) {
+	// The observer chat only receives mirrored queries
+	if b.observerChatID != 0 && msg.Chat.ID == b.observerChatID {
+		return
+	}
+
 	// Check authorization
-	if msg.From.ID != b.authorizedUID {
+	if !b.isAuthorized(msg.From.ID) {
 		log.Printf("Unauthorized access attempt from user %d", msg.From.ID)
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "❌ Unauthorized")
+		b.audit(msg.From.ID, msg.Chat.ID, "message", msg.Text, "unauthorized")
+		reply := tgbotapi.NewMessage(msg.Chat.ID, b.t("unauthorized"))
 		b.api.Send(reply)
 		return
 	}
+	log.Printf("Message from user %d (@%s)", msg.From.ID, msg.From.UserName)
 
 	// Handle commands
 	if msg.IsCommand() {
@@ -131,48 +348,80 @@ func (b *Bot) handleMessage(ctx context.Context, msg *tgbotapi.Message) {
 		return
 	}
 
-	// Forward text message to Claude
+	// Uploaded files are only used by commands in their caption
+	if msg.Document != nil {
+		go b.handleDocument(ctx, msg)
+		return
+	}
+
+	// Voice and audio messages are transcribed into prompts
+	if msg.Voice != nil || msg.Audio != nil {
+		go b.handleVoice(ctx, msg)
+		return
+	}
+
+	// Forward text message to Claude without blocking the update loop
 	if msg.Text != "" {
-		b.forwardToClaude(ctx, msg)
+		b.submitPrompt(ctx, msg, msg.Text)
 		return
 	}
 }
 
 // handleCommand handles bot commands
 func (b *Bot) handleCommand(ctx context.Context, msg *tgbotapi.Message) {
-	switch msg.Command() {
+	outcome := "handled"
+	defer func() { b.audit(msg.From.ID, msg.Chat.ID, "command", msg.Text, outcome) }()
+
+	if b.executeCommand(ctx, msg, msg.Command()) {
+		return
+	}
+
+	// Canonical commands always win; aliases only apply to unknown names
+	if canonical, ok := b.aliases[msg.Command()]; ok && b.executeCommand(ctx, msg, canonical) {
+		return
+	}
+
+	outcome = "unknown command"
+	text := b.t("unknown_command")
+	if matches := suggestCommands(msg.Command()); len(matches) > 0 {
+		text += "\n" + b.t("did_you_mean", strings.Join(matches, " "))
+	}
+	b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, text))
+}
+
+// executeCommand runs a canonical command. Returns false if the command is unknown.
+func (b *Bot) executeCommand(ctx context.Context, msg *tgbotapi.Message, command string) bool {
+	switch command {
 	case "start":
-		reply := tgbotapi.NewMessage(msg.Chat.ID,
-			"Welcome to omnik - Claude Code on Telegram\n\n"+
-				"Send me any message and I'll forward it to Claude!\n\n"+
-				"File Navigation:\n"+
-				"/pwd - Show current working directory\n"+
-				"/ls - List files (ls -lah)\n"+
-				"/cd <path> - Change directory\n"+
-				"/cat <file> - Show file contents\n"+
-				"/exec <cmd> - Execute bash command\n\n"+
-				"Session Management:\n"+
-				"/sessions - List all sessions\n"+
-				"/newsession <name> [description] - Create new session\n"+
-				"/switch <name> - Switch to session\n"+
-				"/delsession <name> - Delete session\n"+
-				"/status - Show current session status")
-		b.api.Send(reply)
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.commandSummary()))
+
+	case "help":
+		name := strings.TrimPrefix(strings.TrimSpace(msg.CommandArguments()), "/")
+		if name == "" {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.commandSummary()))
+			return true
+		}
+		if canonical, ok := b.aliases[name]; ok {
+			name = canonical
+		}
+		cmd, ok := findCommand(name)
+		if !ok {
+			text := b.t("help_unknown", name)
+			if matches := suggestCommands(name); len(matches) > 0 {
+				text += "\n" + b.t("did_you_mean", strings.Join(matches, " "))
+			}
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, text))
+			return true
+		}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.commandHelp(cmd)))
 
 	case "status":
-		currentSession := b.sessionManager.Current()
+		currentSession := b.currentSession(msg.Chat.ID)
 		var status string
 		if currentSession == nil {
-			status = "No active session\n\nUse /newsession to create one"
+			status = b.t("no_session")
 		} else {
-			status = fmt.Sprintf(
-				"Current Session\n\n"+
-					"Name: %s\n"+
-					"Description: %s\n"+
-					"Working Dir: %s\n"+
-					"Created: %s\n"+
-					"Last Used: %s\n"+
-					"Session ID: %s",
+			status = b.t("status_session",
 				currentSession.Name,
 				currentSession.Description,
 				currentSession.WorkingDir,
@@ -180,32 +429,100 @@ func (b *Bot) handleCommand(ctx context.Context, msg *tgbotapi.Message) {
 				currentSession.LastUsedAt.Format("2006-01-02 15:04"),
 				currentSession.ID,
 			)
+			if len(currentSession.Tags) > 0 {
+				status += "\n" + b.t("status_tags", b.formatTags(currentSession.Tags))
+			}
+			if currentSession.QueryCount > 0 {
+				status += "\n" + b.tn("status_cost", currentSession.QueryCount, currentSession.TotalCostUSD)
+			}
+			if currentSession.SystemPrompt != "" {
+				status += "\n" + b.t("status_system_prompt", truncateRunes(currentSession.SystemPrompt, 300))
+			}
+			if len(currentSession.AllowedTools) > 0 {
+				status += "\n" + b.t("status_tools", strings.Join(currentSession.AllowedTools, ", "))
+			}
+		}
+
+		health := b.getHealth()
+		if health.Healthy {
+			status += "\n\n" + b.t("status_healthy", health.CheckedAt.Format("15:04"))
+		} else {
+			status += "\n\n" + b.t("status_unhealthy", health.CheckedAt.Format("15:04"), health.Err)
 		}
+
 		reply := tgbotapi.NewMessage(msg.Chat.ID, status)
 		b.api.Send(reply)
 
 	case "sessions":
+		// Arguments are an optional sort key and optional #tag filters
+		sortKey := "recent"
+		var tagFilters []string
+		for _, arg := range strings.Fields(msg.CommandArguments()) {
+			if strings.HasPrefix(arg, "#") {
+				tagFilters = append(tagFilters, normalizeTag(arg))
+				continue
+			}
+			if arg != "recent" && arg != "created" && arg != "name" && arg != "size" {
+				b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/sessions [recent|created|name|size] [#tag]")))
+				return true
+			}
+			sortKey = arg
+		}
+
 		sessions := b.sessionManager.List()
+		if len(tagFilters) > 0 {
+			filtered := sessions[:0]
+			for _, s := range sessions {
+				if hasAllTags(s, tagFilters) {
+					filtered = append(filtered, s)
+				}
+			}
+			sessions = filtered
+		}
 		if len(sessions) == 0 {
-			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "No sessions found\n\nUse /newsession to create one"))
-			return
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("no_sessions")))
+			return true
 		}
 
+		// Look up transcript sizes once per call
+		var sizes map[string]int64
+		if sortKey == "size" {
+			sizes = make(map[string]int64, len(sessions))
+			for _, s := range sessions {
+				size, err := b.sessionManager.GetSessionSize(s.Name)
+				if err != nil {
+					log.Printf("Warning: failed to get size of session %s: %v", s.Name, err)
+				}
+				sizes[s.Name] = size
+			}
+		}
+		sortSessions(sessions, sortKey, sizes)
+
 		var text strings.Builder
-		text.WriteString(fmt.Sprintf("Sessions (%d)\n\n", len(sessions)))
+		text.WriteString(b.t("sessions_header", len(sessions), sortKey) + "\n\n")
 
-		currentSession := b.sessionManager.Current()
+		currentSession := b.currentSession(msg.Chat.ID)
 		for _, s := range sessions {
 			marker := "  "
 			if currentSession != nil && s.Name == currentSession.Name {
 				marker = "→ "
 			}
-			text.WriteString(fmt.Sprintf("%s%s\n", marker, s.Name))
+			pin := ""
+			if s.Pinned {
+				pin = "📌 "
+			}
+			text.WriteString(fmt.Sprintf("%s%s%s\n", marker, pin, s.Name))
 			if s.Description != "" {
 				text.WriteString(fmt.Sprintf("   %s\n", s.Description))
 			}
-			text.WriteString(fmt.Sprintf("   Dir: %s\n", s.WorkingDir))
-			text.WriteString(fmt.Sprintf("   Last used: %s\n\n", s.LastUsedAt.Format("2006-01-02 15:04")))
+			text.WriteString("   " + b.t("sessions_dir", s.WorkingDir) + "\n")
+			if len(s.Tags) > 0 {
+				text.WriteString("   " + b.t("status_tags", b.formatTags(s.Tags)) + "\n")
+			}
+			if sizes != nil {
+				text.WriteString("   " + b.t("info_size", formatSize(sizes[s.Name])) + "\n")
+			}
+			text.WriteString("   " + b.t("sessions_last_used", s.LastUsedAt.Format("2006-01-02 15:04")) + "\n\n")
 		}
 
 		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, text.String()))
@@ -213,8 +530,8 @@ func (b *Bot) handleCommand(ctx context.Context, msg *tgbotapi.Message) {
 	case "newsession":
 		args := strings.TrimSpace(msg.CommandArguments())
 		if args == "" {
-			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "Usage: /newsession <name> [description]"))
-			return
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/newsession <name> [description]")))
+			return true
 		}
 
 		// Parse name and description
@@ -225,252 +542,1298 @@ func (b *Bot) handleCommand(ctx context.Context, msg *tgbotapi.Message) {
 			description = parts[1]
 		}
 
-		// Create new session
-		newSession, err := b.sessionManager.Create(name, description, "/workspace")
-		if err != nil {
-			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("Error: %v", err)))
-			return
-		}
+		// Each session gets its own directory under the workspace root
+		dir := filepath.Join(sessionsRoot(b.workspaceRoot), sanitizeDirName(name))
 
-		// Update bot's working directory
-		b.workingDir = newSession.WorkingDir
+		// Don't silently attach to someone else's files
+		if dirNonEmpty(dir) {
+			b.askConfirm(msg.Chat.ID, b.t("newsession_dir_exists", dir, name), b.t("button_use_anyway"), func() {
+				b.createSession(msg.Chat.ID, name, description, dir)
+			})
+			return true
+		}
 
-		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("Created and switched to session: %s", name)))
+		b.createSession(msg.Chat.ID, name, description, dir)
 
 	case "switch":
 		args := strings.TrimSpace(msg.CommandArguments())
 		if args == "" {
-			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "Usage: /switch <name>"))
-			return
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/switch <name>")))
+			return true
 		}
 
 		// Switch session
 		switchedSession, err := b.sessionManager.Switch(args)
 		if err != nil {
-			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("Error: %v", err)))
-			return
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return true
 		}
 
-		// Update bot's working directory
-		b.workingDir = switchedSession.WorkingDir
+		b.setChatSession(msg.Chat.ID, switchedSession)
 
-		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf(
-			"Switched to session: %s\nWorking directory: %s",
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("switched_session",
 			switchedSession.Name,
 			switchedSession.WorkingDir,
 		)))
 
+	case "fork":
+		newName := strings.TrimSpace(msg.CommandArguments())
+		if newName == "" {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/fork <newname>")))
+			return true
+		}
+
+		currentSession := b.currentSession(msg.Chat.ID)
+		if currentSession == nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("no_session")))
+			return true
+		}
+
+		fork, err := b.sessionManager.Fork(currentSession.Name, newName)
+		if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return true
+		}
+		b.setChatSession(msg.Chat.ID, fork)
+
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("forked_session",
+			currentSession.Name, fork.Name, fork.WorkingDir, currentSession.Name,
+		)))
+
 	case "delsession":
 		args := strings.TrimSpace(msg.CommandArguments())
 		if args == "" {
-			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "Usage: /delsession <name>"))
-			return
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/delsession <name>")))
+			return true
 		}
 
 		// Delete session
-		if err := b.sessionManager.Delete(args); err != nil {
-			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("Error: %v", err)))
-			return
+		deleted, err := b.sessionManager.Get(args)
+		if err == nil {
+			err = b.sessionManager.Delete(args)
 		}
+		if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return true
+		}
+		b.forgetSession(deleted.Name)
 
-		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("Deleted session: %s", args)))
-
-	case "pwd":
-		b.execDirectCommand(msg, "pwd")
-
-	case "ls":
-		b.execDirectCommand(msg, "ls", "-lah", b.workingDir)
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("deleted_session", args)))
 
-	case "cd":
+	case "raw":
+		// Send text to Claude verbatim, e.g. prompts that start with "/"
 		args := strings.TrimSpace(msg.CommandArguments())
 		if args == "" {
-			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "Usage: /cd <path>"))
-			return
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/raw <text>")))
+			return true
 		}
+		b.submitPrompt(ctx, msg, args)
 
-		// Resolve to absolute path
-		var newDir string
-		if strings.HasPrefix(args, "/") {
-			// Already absolute
-			newDir = args
+	case "tag", "untag":
+		tag := normalizeTag(strings.TrimSpace(msg.CommandArguments()))
+		if tag == "" {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/"+command+" <tag>")))
+			return true
+		}
+
+		currentSession := b.currentSession(msg.Chat.ID)
+		if currentSession == nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("no_session")))
+			return true
+		}
+
+		var err error
+		if command == "tag" {
+			err = b.sessionManager.AddTag(currentSession.Name, tag)
 		} else {
-			// Relative to current working directory
-			newDir = b.workingDir + "/" + args
+			err = b.sessionManager.RemoveTag(currentSession.Name, tag)
+		}
+		if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return true
 		}
 
-		// Clean the path (resolve .., ., etc.)
-		newDir = cleanPath(newDir)
+		updated, err := b.sessionManager.Get(currentSession.Name)
+		if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return true
+		}
 
-		// Verify directory exists
-		if _, err := os.Stat(newDir); os.IsNotExist(err) {
-			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("Directory does not exist: %s", newDir)))
-			return
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("session_tags",
+			updated.Name,
+			b.formatTags(updated.Tags),
+		)))
+
+	case "stop":
+		// "/stop all" also drops prompts queued behind the query
+		cleared := 0
+		if strings.TrimSpace(msg.CommandArguments()) == "all" {
+			cleared = b.clearQueue(msg.Chat.ID)
+		}
+		if !b.stopQuery(msg.Chat.ID, b.t("query_stopped")) {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("no_active_query")))
+		} else if cleared > 0 {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("queue_cleared", cleared)))
+		}
+
+	case "abortall":
+		if !b.isAdmin(msg.From.ID) {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("admin_only")))
+			return true
 		}
 
-		b.workingDir = newDir
+		count := b.stopAllQueries(b.t("aborted_by_admin"))
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.tn("aborted_queries", count)))
 
-		// Save working directory to session
-		if err := b.sessionManager.UpdateWorkingDir(newDir); err != nil {
-			log.Printf("Warning: failed to save working directory: %v", err)
+	case "log":
+		if !b.isAdmin(msg.From.ID) {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("admin_only")))
+			return true
 		}
 
-		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, fmt.Sprintf("Working directory changed to: %s", b.workingDir)))
+		if b.logFile == "" {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("log_disabled")))
+			return true
+		}
 
-	case "cat":
-		args := strings.TrimSpace(msg.CommandArguments())
-		if args == "" {
-			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "Usage: /cat <filename>"))
-			return
+		n := defaultLogLines
+		if arg := strings.TrimSpace(msg.CommandArguments()); arg != "" {
+			var err error
+			n, err = strconv.Atoi(arg)
+			if err != nil || n <= 0 {
+				b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/log [lines]")))
+				return true
+			}
+			if n > maxLogLines {
+				n = maxLogLines
+			}
 		}
 
-		// Resolve to absolute path if relative
-		filePath := args
-		if !strings.HasPrefix(args, "/") {
-			filePath = b.workingDir + "/" + args
+		lines, err := tailLines(b.logFile, n)
+		if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return true
+		}
+		b.sendCodeBlock(msg.Chat.ID, formatLogTail(lines), "")
+
+	case "model":
+		model := strings.ToLower(strings.TrimSpace(msg.CommandArguments()))
+		if model == "" {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t(
+				"current_model", b.queryModel(msg.Chat.ID), b.t("usage", "/model <"+strings.Join(chatModelNames, "|")+"|default>"))))
+			return true
 		}
-		b.execDirectCommand(msg, "cat", filePath)
 
-	case "exec":
-		args := strings.TrimSpace(msg.CommandArguments())
-		if args == "" {
-			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "Usage: /exec <command>"))
-			return
+		if model == "default" || model == "none" {
+			b.setChatModel(msg.Chat.ID, "")
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("model_cleared", b.queryModel(msg.Chat.ID))))
+			return true
+		}
+		if !isChatModel(model) {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t(
+				"unknown_model", model, strings.Join(chatModelNames, ", "))))
+			return true
 		}
-		b.execDirectCommand(msg, "bash", "-c", fmt.Sprintf("cd %s && %s", b.workingDir, args))
 
-	default:
-		reply := tgbotapi.NewMessage(msg.Chat.ID, "Unknown command. Use /start for help.")
-		b.api.Send(reply)
-	}
-}
+		b.setChatModel(msg.Chat.ID, model)
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("model_set", model)))
 
-// execDirectCommand executes a command directly using os/exec
-func (b *Bot) execDirectCommand(msg *tgbotapi.Message, command string, args ...string) {
-	log.Printf("Executing command directly: %s %v", command, args)
+	case "setdefaultmodel":
+		if !b.isAdmin(msg.From.ID) {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("admin_only")))
+			return true
+		}
 
-	// Send thinking message
-	thinkingMsg := tgbotapi.NewMessage(msg.Chat.ID, "Executing...")
-	sentMsg, err := b.api.Send(thinkingMsg)
-	if err != nil {
-		log.Printf("Failed to send thinking message: %v", err)
-		return
-	}
+		model := strings.TrimSpace(msg.CommandArguments())
+		if model == "" {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t(
+				"current_default_model", b.getDefaultModel(), b.t("usage", "/setdefaultmodel <model>"))))
+			return true
+		}
 
-	// Execute command
-	cmd := exec.Command(command, args...)
-	cmd.Dir = b.workingDir
-	output, err := cmd.CombinedOutput()
+		b.setDefaultModel(model)
+		text := b.t("default_model_set", model)
 
-	// Prepare response text
-	var text string
-	if err != nil {
-		text = fmt.Sprintf("Error: %v\n\nOutput:\n%s", err, string(output))
-	} else {
-		text = string(output)
-		if text == "" {
-			text = "✓ Command executed successfully (no output)"
+		// Persist to the config file so the change survives restarts
+		if b.configFile == "" {
+			text += "\n\n" + b.t("default_model_not_saved")
+		} else if err := setConfigValue(b.configFile, "CLAUDE_MODEL", model); err != nil {
+			text += "\n\n" + b.t("default_model_save_failed", b.configFile, err)
+		} else {
+			text += "\n" + b.t("default_model_saved", b.configFile)
+			if _, ok := os.LookupEnv("CLAUDE_MODEL"); ok {
+				text += "\n\n" + b.t("default_model_env_override")
+			}
 		}
-	}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, text))
 
-	// Truncate if too long
-	if len(text) > 4000 {
-		text = text[:4000] + "\n\n... (truncated)"
-	}
+	case "ctx":
+		if !b.isAdmin(msg.From.ID) {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("admin_only")))
+			return true
+		}
 
-	// Send result
-	editMsg := tgbotapi.NewEditMessageText(msg.Chat.ID, sentMsg.MessageID, text)
-	b.api.Send(editMsg)
-}
+		var text strings.Builder
+		text.WriteString(b.t("ctx_chat", msg.Chat.ID, msg.From.ID) + "\n\n")
 
-// forwardToClaude forwards a message to Claude and streams the response
-func (b *Bot) forwardToClaude(ctx context.Context, msg *tgbotapi.Message) {
-	log.Printf("→ Forwarding to Claude: %s", msg.Text)
+		if currentSession := b.currentSession(msg.Chat.ID); currentSession != nil {
+			sessionID := currentSession.ID
+			if sessionID == "" {
+				sessionID = b.t("not_started")
+			}
+			text.WriteString(b.t("ctx_session", currentSession.Name, sessionID, currentSession.WorkingDir) + "\n")
+		} else {
+			text.WriteString(b.t("ctx_no_session") + "\n")
+		}
+		text.WriteString(b.t("ctx_working_dir", b.getWorkingDir(msg.Chat.ID)) + "\n\n")
 
-	// Get current session
-	currentSession := b.sessionManager.Current()
-	if currentSession == nil {
-		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, "No active session. Use /newsession to create one."))
-		return
-	}
+		if name, profile, ok := b.chatProfile(msg.Chat.ID); ok {
+			text.WriteString(b.t("ctx_profile", name, b.describeProfile(profile)) + "\n")
+		} else {
+			text.WriteString(b.t("ctx_no_profile") + "\n")
+		}
+		text.WriteString(b.t("ctx_model", b.queryModel(msg.Chat.ID)) + "\n\n")
 
-	// Send "thinking" message
-	thinkingMsg := tgbotapi.NewMessage(msg.Chat.ID, "🤔 Processing...")
-	sentMsg, err := b.api.Send(thinkingMsg)
-	if err != nil {
-		log.Printf("Failed to send thinking message: %v", err)
-		return
-	}
+		queryState := b.t("query_idle")
+		if b.hasRunningQuery(msg.Chat.ID) {
+			queryState = b.t("query_running")
+		}
+		text.WriteString(b.t("ctx_query", queryState) + "\n")
+		text.WriteString(b.t("ctx_pending_permissions", b.pendingPermissionCount(msg.Chat.ID)) + "\n")
+		text.WriteString(b.t("ctx_scheduled_jobs", len(b.schedules.List(msg.Chat.ID))))
 
-	// Query Claude with bypassed permissions for autonomous operation
-	req := claude.QueryRequest{
-		Prompt:         msg.Text,
-		SessionID:      currentSession.ID,
-		Workspace:      b.workingDir,
-		PermissionMode: "bypassPermissions", // Skip all permission prompts
-	}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, text.String()))
 
-	responseChan, errorChan := b.claudeClient.Query(ctx, req)
+	case "version":
+		claudeVersion := b.t("version_unknown")
+		if reporter, ok := b.claudeClient.(claude.VersionReporter); ok {
+			if v, err := reporter.Version(ctx); err != nil {
+				claudeVersion = b.t("version_unavailable", err)
+			} else {
+				claudeVersion = v
+			}
+		}
 
-	var fullResponse strings.Builder
-	var lastEdit int
-	messageCount := 0
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("version",
+			version.Version,
+			version.Commit,
+			version.BuildDate,
+			runtime.Version(),
+			claudeVersion,
+		)))
 
-	for {
-		select {
-		case err := <-errorChan:
+	case "pin", "unpin":
+		// Defaults to the current session
+		name := strings.TrimSpace(msg.CommandArguments())
+		if name == "" {
+			currentSession := b.currentSession(msg.Chat.ID)
+			if currentSession == nil {
+				b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/"+command+" [name]")))
+				return true
+			}
+			name = currentSession.Name
+		}
+
+		if err := b.sessionManager.SetPinned(name, command == "pin"); err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return true
+		}
+
+		if command == "pin" {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("pinned_session", name)))
+		} else {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("unpinned_session", name)))
+		}
+
+	case "clear":
+		currentSession := b.currentSession(msg.Chat.ID)
+		if currentSession == nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("no_session")))
+			return true
+		}
+
+		name := currentSession.Name
+		b.askConfirm(msg.Chat.ID, b.t("clear_prompt", name, currentSession.WorkingDir), b.t("button_clear"), func() {
+			archivePath, err := b.sessionManager.Clear(name)
 			if err != nil {
-				log.Printf("Claude query error: %v", err)
-				editMsg := tgbotapi.NewEditMessageText(
-					msg.Chat.ID,
-					sentMsg.MessageID,
-					fmt.Sprintf("❌ Error: %v", err),
-				)
-				b.api.Send(editMsg)
+				b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
 				return
 			}
 
-		case response, ok := <-responseChan:
-			if !ok {
-				// Channel closed
-				return
+			text := b.t("cleared_session", name)
+			if archivePath != "" {
+				text += "\n" + b.t("transcript_archived", archivePath)
 			}
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, text))
+		})
+
+	case "schedule":
+		parts := strings.SplitN(strings.TrimSpace(msg.CommandArguments()), " ", 2)
+		if len(parts) < 2 || strings.TrimSpace(parts[1]) == "" {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/schedule <@hourly|@daily|@weekly|duration> <prompt>")+"\n\n"+b.t("examples")+"\n/schedule @daily Summarize new GitHub issues"))
+			return true
+		}
 
-			messageCount++
+		job, err := b.schedules.Add(msg.Chat.ID, msg.From.ID, parts[0], strings.TrimSpace(parts[1]))
+		if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return true
+		}
 
-			switch response.Type {
-			case "claude_message":
-				// Parse SDK message
-				var sdkMsg map[string]interface{}
-				if err := json.Unmarshal(response.Data, &sdkMsg); err != nil {
-					log.Printf("Failed to parse SDK message: %v", err)
-					continue
-				}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("job_scheduled",
+			job.ID, job.Spec, job.NextRun.Format("2006-01-02 15:04"),
+		)))
 
-				// Extract session ID if this is a system message
-				if msgType, ok := sdkMsg["type"].(string); ok && msgType == "system" {
-					if sessionID, ok := sdkMsg["session_id"].(string); ok && sessionID != "" {
-						// Update session with ID from Claude
-						if currentSession.ID == "" {
-							currentSession.ID = sessionID
-							if err := b.sessionManager.UpdateSessionID(currentSession.Name, sessionID); err != nil {
-								log.Printf("Warning: failed to update session ID: %v", err)
-							} else {
-								log.Printf("Session ID set: %s", sessionID)
-							}
-						}
-					}
-				}
+	case "schedules":
+		jobs := b.schedules.List(msg.Chat.ID)
+		if len(jobs) == 0 {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("no_jobs")))
+			return true
+		}
 
-				// Extract text content from assistant messages
-				if msgType, ok := sdkMsg["type"].(string); ok && msgType == "assistant" {
-					if message, ok := sdkMsg["message"].(map[string]interface{}); ok {
-						if content, ok := message["content"].([]interface{}); ok {
-							for _, item := range content {
-								if contentItem, ok := item.(map[string]interface{}); ok {
-									if contentType, ok := contentItem["type"].(string); ok && contentType == "text" {
-										if text, ok := contentItem["text"].(string); ok {
+		var text strings.Builder
+		text.WriteString(b.t("jobs_header", len(jobs)) + "\n\n")
+		for _, job := range jobs {
+			text.WriteString(fmt.Sprintf("#%d %s\n", job.ID, job.Spec))
+			text.WriteString(fmt.Sprintf("   %s\n", truncateRunes(job.Prompt, 100)))
+			text.WriteString("   " + b.t("next_run", job.NextRun.Format("2006-01-02 15:04")) + "\n\n")
+		}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, text.String()))
+
+	case "unschedule":
+		id, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(msg.CommandArguments()), "#"))
+		if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/unschedule <id>")))
+			return true
+		}
+
+		if err := b.schedules.Remove(msg.Chat.ID, id); err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return true
+		}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("removed_job", id)))
+
+	case "mcptest":
+		name := strings.TrimSpace(msg.CommandArguments())
+		if name == "" {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/mcptest <server>")))
+			return true
+		}
+
+		dir := b.getWorkingDir(msg.Chat.ID)
+		cfg, err := loadMCPConfig(dir)
+		if os.IsNotExist(err) {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("file_not_found", mcpConfigPath(dir))))
+			return true
+		} else if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return true
+		}
+
+		server, ok := cfg.MCPServers[name]
+		if !ok {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t(
+				"mcp_unknown", name, strings.Join(sortedKeys(cfg.MCPServers), ", "))))
+			return true
+		}
+
+		// Probing can take seconds; don't hold up the update loop
+		go func() {
+			result, err := b.probeMCPServer(ctx, dir, server)
+			if err != nil {
+				b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("mcp_failed", name, server.transport(), err)))
+				return
+			}
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("mcp_ok", name, server.transport(), result)))
+		}()
+
+	case "mcpconfig":
+		dir := b.getWorkingDir(msg.Chat.ID)
+		path := mcpConfigPath(dir)
+
+		if strings.TrimSpace(msg.CommandArguments()) == "raw" {
+			err := checkTextFile(path)
+			var data []byte
+			if err == nil {
+				data, err = os.ReadFile(path)
+			}
+			if os.IsNotExist(err) {
+				b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("file_not_found", path)))
+				return true
+			} else if err != nil {
+				b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+				return true
+			}
+			b.sendCodeBlock(msg.Chat.ID, string(data), "json")
+			return true
+		}
+
+		cfg, err := loadMCPConfig(dir)
+		if os.IsNotExist(err) {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("file_not_found", path)))
+			return true
+		} else if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return true
+		}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.formatMCPConfig(path, cfg)))
+
+	case "system":
+		currentSession := b.currentSession(msg.Chat.ID)
+		if currentSession == nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("no_session")))
+			return true
+		}
+
+		prompt := strings.TrimSpace(msg.CommandArguments())
+		if err := b.sessionManager.SetSystemPrompt(currentSession.Name, prompt); err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return true
+		}
+
+		if prompt == "" {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("system_prompt_cleared", currentSession.Name)))
+		} else {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("system_prompt_set", currentSession.Name, prompt)))
+		}
+
+	case "tools":
+		currentSession := b.currentSession(msg.Chat.ID)
+		if currentSession == nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("no_session")))
+			return true
+		}
+
+		args := strings.TrimSpace(msg.CommandArguments())
+		if args == "" {
+			tools := b.t("tools_default", strings.Join(claude.DefaultAllowedTools, ", "))
+			if len(currentSession.AllowedTools) > 0 {
+				tools = strings.Join(currentSession.AllowedTools, ", ")
+			}
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("session_tools", currentSession.Name, tools)))
+			return true
+		}
+
+		tools := parseToolList(args)
+		if args == "default" {
+			tools = nil
+		}
+		if err := b.sessionManager.SetAllowedTools(currentSession.Name, tools); err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return true
+		}
+
+		if tools == nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("session_tools_restored", currentSession.Name)))
+		} else {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("session_tools", currentSession.Name, strings.Join(tools, ", "))))
+		}
+
+	case "history":
+		n := 10
+		if arg := strings.TrimSpace(msg.CommandArguments()); arg != "" {
+			var err error
+			n, err = strconv.Atoi(arg)
+			if err != nil || n <= 0 {
+				b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/history [n]")))
+				return true
+			}
+			if n > 50 {
+				n = 50
+			}
+		}
+
+		currentSession := b.currentSession(msg.Chat.ID)
+		if currentSession == nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("no_session")))
+			return true
+		}
+		messages, err := b.sessionManager.ReadRecentMessages(currentSession.Name, n)
+		if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return true
+		}
+		if len(messages) == 0 {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("no_conversation", currentSession.Name)))
+			return true
+		}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.formatHistory(currentSession.Name, messages)))
+
+	case "sessionid":
+		currentSession := b.currentSession(msg.Chat.ID)
+		if currentSession == nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("no_session")))
+			return true
+		}
+		if currentSession.ID == "" {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("no_session_id", currentSession.Name)))
+			return true
+		}
+
+		transcript, err := b.sessionManager.TranscriptPath(currentSession.Name)
+		if os.IsNotExist(err) {
+			transcript = b.t("transcript_not_found")
+		} else if err != nil {
+			transcript = b.t("transcript_error", err)
+		}
+
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("session_id",
+			currentSession.Name, currentSession.ID, transcript, currentSession.WorkingDir, currentSession.ID)))
+
+	case "cost":
+		var text strings.Builder
+		if currentSession := b.currentSession(msg.Chat.ID); currentSession != nil {
+			text.WriteString(b.tn("cost_session", currentSession.QueryCount, currentSession.Name, currentSession.TotalCostUSD) + "\n\n")
+		}
+
+		var total float64
+		var queries int
+		for _, s := range b.sessionManager.List() {
+			total += s.TotalCostUSD
+			queries += s.QueryCount
+		}
+		text.WriteString(b.tn("cost_all", queries, total))
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, text.String()))
+
+	case "usage":
+		currentSession := b.currentSession(msg.Chat.ID)
+		if currentSession == nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("no_session")))
+			return true
+		}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.tn("session_usage", currentSession.QueryCount, currentSession.Name,
+			b.formatUsage(currentSession.InputTokens, currentSession.OutputTokens, currentSession.TotalCostUSD))))
+
+	case "exportsessions":
+		if err := b.exportSessions(msg.Chat.ID); err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+		}
+
+	case "importsessions":
+		// The index itself arrives as a captioned document, see handleDocument
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("import_usage")))
+
+	case "delsessions":
+		// Pattern plus optional flag to allow matching the active session
+		includeCurrent := false
+		var pattern string
+		for _, arg := range strings.Fields(msg.CommandArguments()) {
+			if arg == "--include-current" {
+				includeCurrent = true
+			} else {
+				pattern = arg
+			}
+		}
+		if pattern == "" {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/delsessions <pattern> [--include-current]")+"\n\n"+b.t("delsessions_pattern")))
+			return true
+		}
+
+		matches, err := b.sessionManager.Search(pattern)
+		if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return true
+		}
+
+		currentSession := b.currentSession(msg.Chat.ID)
+		var names []string
+		skippedCurrent := false
+		for _, s := range matches {
+			if !includeCurrent && currentSession != nil && s.Name == currentSession.Name {
+				skippedCurrent = true
+				continue
+			}
+			names = append(names, s.Name)
+		}
+
+		if len(names) == 0 {
+			text := b.t("no_sessions_match", pattern)
+			if skippedCurrent {
+				text += "\n\n" + b.t("delsessions_current_matched")
+			}
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, text))
+			return true
+		}
+
+		prompt := b.tn("delsessions_prompt", len(names), pattern, strings.Join(names, "\n"))
+		if skippedCurrent {
+			prompt += "\n\n" + b.t("delsessions_current_skipped")
+		}
+		b.askConfirm(msg.Chat.ID, prompt, b.t("button_delete"), func() {
+			var deleted, failed []string
+			for _, name := range names {
+				if _, err := b.sessionManager.Archive(name); err != nil {
+					log.Printf("Failed to archive session %s: %v", name, err)
+					failed = append(failed, name)
+					continue
+				}
+				if err := b.sessionManager.Delete(name); err != nil {
+					log.Printf("Failed to delete session %s: %v", name, err)
+					failed = append(failed, name)
+					continue
+				}
+				b.forgetSession(name)
+				deleted = append(deleted, name)
+			}
+
+			text := b.tn("deleted_sessions", len(deleted))
+			if len(failed) > 0 {
+				text += "\n" + b.t("delete_failed", strings.Join(failed, ", "))
+			}
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, text))
+		})
+
+	case "profile":
+		name := strings.ToLower(strings.TrimSpace(msg.CommandArguments()))
+		if name == "" {
+			var text strings.Builder
+			activeName, active, ok := b.chatProfile(msg.Chat.ID)
+			if ok {
+				text.WriteString(b.t("active_profile", activeName, b.describeProfile(active)) + "\n\n")
+			} else {
+				text.WriteString(b.t("no_active_profile") + "\n\n")
+			}
+			text.WriteString(b.t("available_profiles") + "\n")
+			for _, n := range b.profileNames() {
+				text.WriteString(fmt.Sprintf("• %s - %s\n", n, b.describeProfile(b.profiles[n])))
+			}
+			text.WriteString("\n" + b.t("profile_hint"))
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, text.String()))
+			return true
+		}
+
+		if name == "none" || name == "default" {
+			b.setChatProfile(msg.Chat.ID, "")
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("profile_cleared")))
+			return true
+		}
+
+		profile, ok := b.profiles[name]
+		if !ok {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t(
+				"unknown_profile", name, strings.Join(b.profileNames(), ", "))))
+			return true
+		}
+
+		b.setChatProfile(msg.Chat.ID, name)
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("profile_switched", name, b.describeProfile(profile))))
+
+	case "pwd":
+		go b.execDirectCommand(msg, "pwd")
+
+	case "ls":
+		if !b.checkSandbox(msg.Chat.ID, b.getWorkingDir(msg.Chat.ID)) {
+			return true
+		}
+		go b.execDirectCommand(msg, "ls", "-lah", b.getWorkingDir(msg.Chat.ID))
+
+	case "cd":
+		args := strings.TrimSpace(msg.CommandArguments())
+		if args == "" {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/cd <path>")))
+			return true
+		}
+
+		// Resolve to absolute path
+		var newDir string
+		if strings.HasPrefix(args, "/") {
+			// Already absolute
+			newDir = args
+		} else {
+			// Relative to current working directory
+			newDir = b.getWorkingDir(msg.Chat.ID) + "/" + args
+		}
+
+		// Clean the path (resolve .., ., etc.)
+		newDir = cleanPath(newDir)
+		if !b.checkSandbox(msg.Chat.ID, newDir) {
+			return true
+		}
+
+		// Verify directory exists
+		if _, err := os.Stat(newDir); os.IsNotExist(err) {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("dir_not_found", newDir)))
+			return true
+		}
+
+		b.setWorkingDir(msg.Chat.ID, newDir)
+
+		// Save working directory to the chat's session
+		if s := b.currentSession(msg.Chat.ID); s != nil {
+			if err := b.sessionManager.UpdateWorkingDir(s.Name, newDir); err != nil {
+				log.Printf("Warning: failed to save working directory: %v", err)
+			}
+		}
+
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("wd_changed", newDir)))
+
+	case "cat":
+		args := strings.TrimSpace(msg.CommandArguments())
+		if args == "" {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/cat <filename>")))
+			return true
+		}
+
+		// Optional trailing line range, e.g. "main.go 10:40"
+		start, end := 0, 0
+		if idx := strings.LastIndex(args, " "); idx > 0 {
+			if rs, re, ok := parseLineRange(args[idx+1:]); ok {
+				start, end = rs, re
+				args = strings.TrimSpace(args[:idx])
+			}
+		}
+
+		filePath := b.resolvePath(msg.Chat.ID, args)
+		if !b.checkSandbox(msg.Chat.ID, filePath) {
+			return true
+		}
+		err := checkTextFile(filePath)
+		var content string
+		if err == nil {
+			content, err = readLines(filePath, start, end)
+		}
+		if os.IsNotExist(err) {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("file_not_found", filePath)))
+			return true
+		} else if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return true
+		}
+
+		b.sendCodeBlock(msg.Chat.ID, content, languageForFile(filePath))
+
+	case "info":
+		args := strings.TrimSpace(msg.CommandArguments())
+		if args == "" {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/info <file>")))
+			return true
+		}
+
+		path := b.resolvePath(msg.Chat.ID, args)
+		if !b.checkSandbox(msg.Chat.ID, path) {
+			return true
+		}
+		text, err := b.describeFile(path)
+		if os.IsNotExist(err) {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("file_not_found", path)))
+			return true
+		} else if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return true
+		}
+
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, text))
+
+	case "du":
+		path := b.getWorkingDir(msg.Chat.ID)
+		if args := strings.TrimSpace(msg.CommandArguments()); args != "" {
+			path = b.resolvePath(msg.Chat.ID, args)
+		}
+		if !b.checkSandbox(msg.Chat.ID, path) {
+			return true
+		}
+
+		text, err := b.describeDiskUsage(path, 5)
+		if os.IsNotExist(err) {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("file_not_found", path)))
+			return true
+		} else if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return true
+		}
+
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, text))
+
+	case "recent":
+		n := 10
+		if arg := strings.TrimSpace(msg.CommandArguments()); arg != "" {
+			var err error
+			n, err = strconv.Atoi(arg)
+			if err != nil || n <= 0 {
+				b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/recent [n]")))
+				return true
+			}
+			if n > 50 {
+				n = 50
+			}
+		}
+
+		dir := b.getWorkingDir(msg.Chat.ID)
+		if !b.checkSandbox(msg.Chat.ID, dir) {
+			return true
+		}
+		files, truncated, err := recentFiles(dir, n)
+		if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return true
+		}
+		if len(files) == 0 {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("no_files_found", dir)))
+			return true
+		}
+
+		var text strings.Builder
+		text.WriteString(b.t("recent_header", dir) + "\n\n")
+		for _, f := range files {
+			text.WriteString(fmt.Sprintf("%s  %s (%s)\n", f.modTime.Format("01-02 15:04"), f.path, formatSize(f.size)))
+		}
+		if truncated {
+			text.WriteString("\n" + b.t("recent_scan_limit", recentMaxFiles))
+		}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, text.String()))
+
+	case "rm":
+		b.handleRemove(msg)
+
+	case "mv":
+		b.handleMoveOrCopy(msg, true)
+
+	case "cp":
+		b.handleMoveOrCopy(msg, false)
+
+	case "download":
+		fields := strings.Fields(msg.CommandArguments())
+		if len(fields) == 0 || len(fields) > 2 {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/download <url> [filename]")))
+			return true
+		}
+		name := ""
+		if len(fields) == 2 {
+			name = fields[1]
+		}
+		go b.downloadURL(ctx, msg, fields[0], name)
+
+	case "exec":
+		args := strings.TrimSpace(msg.CommandArguments())
+		if args == "" {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/exec <command>")))
+			return true
+		}
+		err := checkExecDenied(args, b.execDenylist)
+		if err == nil {
+			err = checkExecAllowed(args, b.execAllowlist)
+		}
+		if err != nil {
+			log.Printf("Rejected /exec from user %d: %q: %v", msg.From.ID, args, err)
+			text := b.t("error", err)
+			var rejected *execRejectedError
+			if errors.As(err, &rejected) {
+				text = b.t(rejected.Key, rejected.Args...)
+			}
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, text))
+			return true
+		}
+		if !b.checkSandbox(msg.Chat.ID, b.getWorkingDir(msg.Chat.ID)) {
+			return true
+		}
+		// Commands can run for minutes; don't hold up the update loop
+		go b.execDirectCommand(msg, "bash", "-c", fmt.Sprintf("cd %s && %s", b.getWorkingDir(msg.Chat.ID), args))
+
+	default:
+		return false
+	}
+
+	return true
+}
+
+// typingInterval is how often the typing action is resent; Telegram
+// clears it after about 5 seconds
+const typingInterval = 4 * time.Second
+
+// showTyping keeps the chat's typing indicator on until ctx is done
+func (b *Bot) showTyping(ctx context.Context, chatID int64) {
+	ticker := time.NewTicker(typingInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := b.api.Request(tgbotapi.NewChatAction(chatID, tgbotapi.ChatTyping)); err != nil {
+			log.Printf("Failed to send typing action: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// heartbeatInterval is how long a query may go without a visible update
+// before an elapsed-time indicator is shown
+const heartbeatInterval = 15 * time.Second
+
+// queryRetryDelay is how long to wait before retrying a failed query
+const queryRetryDelay = 3 * time.Second
+
+// transientStatus matches HTTP statuses worth retrying: rate limiting,
+// server errors and Anthropic's 529 overloaded
+var transientStatus = regexp.MustCompile(`\b(429|500|502|503|504|529)\b`)
+
+// transientSignals are error texts of failures that might succeed on retry
+var transientSignals = []string{
+	"overloaded", "rate limit", "connection reset", "connection refused",
+	"broken pipe", "eof", "temporarily unavailable",
+	"exited without output", // Claude died before saying anything
+}
+
+// isTransientError reports whether a query failure might succeed on retry.
+// Only known transient failures qualify; anything else, such as an invalid
+// model or a parse error, would just fail again.
+func isTransientError(errText string) bool {
+	errText = strings.ToLower(errText)
+	if transientStatus.MatchString(errText) {
+		return true
+	}
+	for _, signal := range transientSignals {
+		if strings.Contains(errText, signal) {
+			return true
+		}
+	}
+	return false
+}
+
+// claudeExitTimeout is how long a finished query waits for its Claude
+// process to exit
+const claudeExitTimeout = 10 * time.Second
+
+// drainResponses discards responses until ch is closed, which happens once
+// the Claude process has exited, or until timeout passes
+func drainResponses(ch <-chan claude.StreamResponse, timeout time.Duration) {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-deadline:
+			log.Printf("Warning: Claude process still running %s after its query ended", timeout)
+			return
+		}
+	}
+}
+
+// forwardToClaude forwards a prompt to Claude and streams the response
+func (b *Bot) forwardToClaude(ctx context.Context, msg *tgbotapi.Message, prompt string) {
+	log.Printf("→ Forwarding to Claude: %s", prompt)
+
+	outcome := "done"
+	defer func() { b.audit(msg.From.ID, msg.Chat.ID, "message", prompt, outcome) }()
+
+	// Reject oversized prompts up front instead of failing in exec
+	if b.maxPromptChars > 0 {
+		if n := utf8.RuneCountInString(prompt); n > b.maxPromptChars {
+			outcome = "rejected: prompt too long"
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("prompt_too_long", n, b.maxPromptChars)))
+			return
+		}
+	}
+
+	// One query per chat at a time; later prompts wait in a queue
+	running, position := b.registerQuery(msg, prompt)
+	if running == nil {
+		switch {
+		case position > 0:
+			outcome = fmt.Sprintf("queued: position %d", position)
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("prompt_queued", position)))
+		case position < 0:
+			outcome = "rejected: shutting down"
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("shutting_down")))
+		default:
+			outcome = "rejected: already processing"
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("already_processing")))
+		}
+		return
+	}
+	defer b.queryWG.Done()
+	defer func() {
+		if next, ok := b.unregisterQuery(msg.Chat.ID, running); ok {
+			go b.forwardToClaude(ctx, next.msg, next.prompt)
+		}
+	}()
+
+	// Get current session
+	currentSession := b.currentSession(msg.Chat.ID)
+	if currentSession == nil {
+		outcome = "no active session"
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("no_session")))
+		return
+	}
+
+	// Fail fast if Claude is known to be down, re-checking in case it recovered
+	if !b.getHealth().Healthy {
+		if health := b.checkHealth(ctx); !health.Healthy {
+			outcome = "claude unavailable"
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("claude_unavailable", health.Err)))
+			return
+		}
+	}
+
+	// Start a fresh conversation once the transcript grows too large
+	if b.autoReloadBytes > 0 {
+		if reload, err := b.sessionManager.ShouldReload(currentSession.Name, b.autoReloadBytes); err != nil {
+			log.Printf("Warning: failed to check session size: %v", err)
+		} else if reload {
+			archivePath, err := b.sessionManager.Clear(currentSession.Name)
+			if err != nil {
+				log.Printf("Warning: failed to auto-reload session %s: %v", currentSession.Name, err)
+			} else {
+				log.Printf("Auto-reloaded session %s, transcript archived to %s", currentSession.Name, archivePath)
+				b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("auto_reloaded", currentSession.Name, b.autoReloadBytes/(1024*1024), archivePath)))
+				currentSession = b.currentSession(msg.Chat.ID)
+			}
+		}
+	}
+
+	// Cancel the Claude process when the query is stopped
+	queryCtx, cancelQuery := context.WithCancel(ctx)
+	defer cancelQuery()
+	go func() {
+		select {
+		case <-running.stop:
+			cancelQuery()
+		case <-queryCtx.Done():
+		}
+	}()
+
+	// Send "thinking" message
+	thinkingMsg := tgbotapi.NewMessage(msg.Chat.ID, b.t("processing"))
+	sentMsg, err := b.api.Send(thinkingMsg)
+	if err != nil {
+		log.Printf("Failed to send thinking message: %v", err)
+		outcome = fmt.Sprintf("error: %v", err)
+		return
+	}
+
+	// edit updates the streaming message, skipping edits that wouldn't
+	// change it
+	lastSent := thinkingMsg.Text
+	edit := func(text string) {
+		if text == lastSent {
+			return
+		}
+		if err := b.editMarkdown(msg.Chat.ID, sentMsg.MessageID, text); err == nil {
+			lastSent = text
+		}
+	}
+
+	// Wait for a free query slot if the server is busy
+	if !b.acquireQuerySlot(queryCtx, msg.Chat.ID, sentMsg.MessageID) {
+		outcome = "cancelled while queued"
+		if reason, stopped := running.stopReason(); stopped {
+			edit(reason)
+		}
+		return
+	}
+	defer b.releaseQuerySlot()
+
+	// Show "typing..." in the chat for as long as Claude works
+	go b.showTyping(queryCtx, msg.Chat.ID)
+
+	// Query Claude with bypassed permissions for autonomous operation
+	req := claude.QueryRequest{
+		Prompt:         prompt,
+		SessionID:      currentSession.ID,
+		Workspace:      b.getWorkingDir(msg.Chat.ID),
+		PermissionMode: "bypassPermissions", // Skip all permission prompts
+		SystemPrompt:   currentSession.SystemPrompt,
+		Model:          b.queryModel(msg.Chat.ID),
+		Timeout:        b.claudeTimeout,
+	}
+
+	// The chat's profile overrides permission mode and tools; its model is
+	// already part of queryModel
+	if _, profile, ok := b.chatProfile(msg.Chat.ID); ok {
+		if profile.PermissionMode != "" {
+			req.PermissionMode = profile.PermissionMode
+		}
+		req.AllowedTools = profile.AllowedTools
+	}
+
+	// A session's tool list narrows the profile's. The tools left out are
+	// disallowed outright, since --allowed-tools restricts nothing in
+	// bypassPermissions mode.
+	if len(currentSession.AllowedTools) > 0 {
+		req.AllowedTools = narrowTools(currentSession.AllowedTools, req.AllowedTools)
+		req.DisallowedTools = disallowedTools(req.AllowedTools)
+	}
+
+	// Outside bypass mode, tool uses Claude needs approval for are asked
+	// about in the chat
+	req.OnPermission = func(ctx context.Context, pr claude.PermissionRequest) bool {
+		return b.askPermission(ctx, msg.Chat.ID, pr)
+	}
+
+	// Each attempt runs under its own context so a failed one is torn down
+	// before it is retried
+	var responseChan <-chan claude.StreamResponse
+	var errorChan <-chan error
+	cancelAttempt := func() {}
+	startAttempt := func() {
+		cancelAttempt()
+		var attemptCtx context.Context
+		attemptCtx, cancelAttempt = context.WithCancel(queryCtx)
+		responseChan, errorChan = b.claudeClient.Query(attemptCtx, req)
+	}
+	// On return, wait for the last attempt's Claude process to exit so
+	// none outlive the query
+	defer func() {
+		cancelAttempt()
+		drainResponses(responseChan, claudeExitTimeout)
+	}()
+	startAttempt()
+
+	var fullResponse strings.Builder
+	var resultError string // Set when Claude's final result reports is_error
+	var lastEdit int
+	messageCount := 0
+	sawAssistant := false // Any assistant output rules out a retry
+	sawResult := false
+	toolCalls := 0    // tool_use blocks seen, for the timings footer
+	inputTokens := 0  // from the final result's usage, cache reads included
+	outputTokens := 0 // from the final result's usage
+	numTurns := 0     // from the final result
+	costUSD := 0.0    // from the final result
+
+	// Images Claude writes are sent after the response when enabled
+	var writtenImages []string
+	seenImages := make(map[string]bool)
+
+	// Heartbeat shows elapsed time when no update has been sent for a while
+	queryStart := time.Now()
+	lastUpdate := queryStart
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	// finishStopped shows the partial response with the stop reason
+	finishStopped := func(reason string) {
+		outcome = "stopped: " + reason
+		text := strings.TrimSpace(fullResponse.String() + "\n\n" + reason)
+		if telegramLen(text) > telegramLimit {
+			text = b.t("truncated") + "\n\n" + tailTelegram(text, telegramLimit)
+		}
+		edit(text)
+	}
+
+	// retry re-runs the query after a transient failure that happened before
+	// Claude produced any output, reporting whether it did so
+	attempts := 0
+	retry := func(errText string) bool {
+		if attempts >= b.queryRetries || sawAssistant || !isTransientError(errText) {
+			return false
+		}
+		attempts++
+		log.Printf("Retrying query after transient failure (%d/%d): %s", attempts, b.queryRetries, errText)
+		edit(b.t("retrying"))
+
+		select {
+		case <-time.After(queryRetryDelay):
+		case <-queryCtx.Done():
+			return false
+		}
+
+		messageCount, resultError, sawResult = 0, "", false
+		lastUpdate = time.Now()
+		startAttempt()
+		return true
+	}
+
+	for {
+		select {
+		case <-running.stop:
+			finishStopped(running.reason)
+			return
+
+		case <-heartbeat.C:
+			if time.Since(lastUpdate) < heartbeatInterval {
+				continue
+			}
+			text := b.t("processing")
+			if fullResponse.Len() > 0 {
+				text = fullResponse.String()
+				if telegramLen(text) > telegramLimit-100 {
+					text = truncateTelegram(text, telegramLimit-100) + "\n\n" + b.t("truncated")
+				}
+			}
+			elapsed := time.Since(queryStart).Round(time.Second)
+			edit(b.t("still_working", text, elapsed))
+
+		case err := <-errorChan:
+			if err != nil {
+				log.Printf("Claude query error: %v", err)
+				if retry(err.Error()) {
+					continue
+				}
+				outcome = fmt.Sprintf("error: %v", err)
+				edit(b.t("query_error", err))
+				return
+			}
+
+		case response, ok := <-responseChan:
+			if !ok {
+				// Channel closed
+				if reason, stopped := running.stopReason(); stopped {
+					finishStopped(reason)
+					return
+				}
+
+				// Closed without a done message: show whatever arrived since
+				// the last rate-limited edit, or say that nothing did
+				if fullResponse.Len() == 0 {
+					outcome = "error: no response"
+					edit(b.t("closed_no_output"))
+					return
+				}
+				text := fullResponse.String()
+				if telegramLen(text) > telegramLimit {
+					text = truncateTelegram(text, telegramLimit) + "\n\n" + b.t("truncated")
+				}
+				edit(text)
+				return
+			}
+
+			messageCount++
+
+			switch response.Type {
+			case "claude_message":
+				// Parse SDK message
+				var sdkMsg map[string]interface{}
+				if err := json.Unmarshal(response.Data, &sdkMsg); err != nil {
+					log.Printf("Failed to parse SDK message: %v", err)
+					continue
+				}
+
+				// Extract session ID if this is a system message
+				if msgType, ok := sdkMsg["type"].(string); ok && msgType == "system" {
+					if sessionID, ok := sdkMsg["session_id"].(string); ok && sessionID != "" {
+						// Update session with ID from Claude
+						if currentSession.ID == "" {
+							currentSession.ID = sessionID
+							if err := b.sessionManager.UpdateSessionID(currentSession.Name, sessionID); err != nil {
+								log.Printf("Warning: failed to update session ID: %v", err)
+							} else {
+								log.Printf("Session ID set: %s", sessionID)
+							}
+						}
+					}
+				}
+
+				// Extract text content from assistant messages
+				if msgType, ok := sdkMsg["type"].(string); ok && msgType == "assistant" {
+					sawAssistant = true
+					if message, ok := sdkMsg["message"].(map[string]interface{}); ok {
+						if content, ok := message["content"].([]interface{}); ok {
+							for _, item := range content {
+								if contentItem, ok := item.(map[string]interface{}); ok {
+									if contentType, ok := contentItem["type"].(string); ok && contentType == "text" {
+										if text, ok := contentItem["text"].(string); ok {
 											fullResponse.WriteString(text)
 										}
+									} else if contentType == "tool_use" {
+										toolCalls++
+										if path, ok := writtenImagePath(contentItem, req.Workspace); ok && b.sendImages && !seenImages[path] {
+											seenImages[path] = true
+											writtenImages = append(writtenImages, path)
+										}
 									}
 								}
 							}
@@ -478,51 +1841,500 @@ func (b *Bot) forwardToClaude(ctx context.Context, msg *tgbotapi.Message) {
 					}
 				}
 
+				// Surface error results (max turns, execution errors) instead of a silent done
+				if msgType, ok := sdkMsg["type"].(string); ok && msgType == "result" {
+					sawResult = true
+					if usage, ok := sdkMsg["usage"].(map[string]interface{}); ok {
+						inputTokens = 0
+						for _, key := range []string{"input_tokens", "cache_creation_input_tokens", "cache_read_input_tokens"} {
+							if n, ok := usage[key].(float64); ok {
+								inputTokens += int(n)
+							}
+						}
+						if n, ok := usage["output_tokens"].(float64); ok {
+							outputTokens = int(n)
+						}
+					}
+					if n, ok := sdkMsg["num_turns"].(float64); ok {
+						numTurns = int(n)
+					}
+					if cost, ok := sdkMsg["total_cost_usd"].(float64); ok {
+						costUSD = cost
+					}
+					if ms, ok := sdkMsg["duration_ms"].(float64); ok {
+						log.Printf("Claude result: %d turns, $%.4f, %dms", numTurns, costUSD, int(ms))
+					}
+					if err := b.sessionManager.RecordUsage(currentSession.Name, costUSD, inputTokens, outputTokens); err != nil {
+						log.Printf("Warning: failed to record session usage: %v", err)
+					}
+					if isError, ok := sdkMsg["is_error"].(bool); ok && isError {
+						subtype, _ := sdkMsg["subtype"].(string)
+						resultError = b.describeResultError(subtype)
+						log.Printf("Claude result error: %s", subtype)
+					}
+				}
+
 				// Update message every 2 seconds or every 10 messages
 				currentTime := msg.Date
 				if messageCount%10 == 0 || currentTime-lastEdit >= 2 {
 					if fullResponse.Len() > 0 {
 						text := fullResponse.String()
-						if len(text) > 4000 {
-							text = text[:4000] + "\n\n... (truncated)"
+						if telegramLen(text) > telegramLimit {
+							text = truncateTelegram(text, telegramLimit) + "\n\n" + b.t("truncated")
 						}
 
-						editMsg := tgbotapi.NewEditMessageText(msg.Chat.ID, sentMsg.MessageID, text)
-						b.api.Send(editMsg)
+						edit(text)
 						lastEdit = currentTime
+						lastUpdate = time.Now()
 					}
 				}
 
 			case "done":
 				log.Printf("← Received %d messages from Claude", messageCount)
 
+				// Claude exiting without any output or result means it died early
+				if !sawAssistant && !sawResult && retry("claude exited without output") {
+					continue
+				}
+
 				// Final update
 				text := fullResponse.String()
+				if resultError != "" {
+					outcome = "error: " + resultError
+					text = strings.TrimSpace(text + "\n\n" + resultError)
+				}
 				if text == "" {
-					text = "✅ Done (no output)"
+					text = b.t("done_no_output")
 				}
-				if len(text) > 4000 {
-					text = text[:4000] + "\n\n... (truncated)"
+				b.mirrorToObserver(currentSession.Name, prompt, text)
+				if sawResult {
+					text += "\n\n" + b.formatUsage(inputTokens, outputTokens, costUSD)
+				}
+				if b.showTimings {
+					text += "\n" + b.formatTimings(time.Since(queryStart), toolCalls, numTurns)
+				}
+
+				// Long responses go out as a document instead of being truncated
+				sentAsFile := false
+				if b.wantsResponseFile(text) {
+					err := b.sendResponseFile(msg.Chat.ID, sentMsg.MessageID, text)
+					if err != nil {
+						log.Printf("Failed to send response as file: %v", err)
+					}
+					sentAsFile = err == nil
 				}
 
-				editMsg := tgbotapi.NewEditMessageText(msg.Chat.ID, sentMsg.MessageID, text)
-				b.api.Send(editMsg)
+				if !sentAsFile {
+					if telegramLen(text) > telegramLimit {
+						text = truncateTelegram(text, telegramLimit) + "\n\n" + b.t("truncated")
+					}
+					edit(text)
+				}
+
+				b.sendWrittenImages(msg.Chat.ID, writtenImages)
 				return
 
 			case "error":
 				log.Printf("Claude error: %s", response.Error)
-				editMsg := tgbotapi.NewEditMessageText(
-					msg.Chat.ID,
-					sentMsg.MessageID,
-					fmt.Sprintf("❌ Error: %s", response.Error),
-				)
-				b.api.Send(editMsg)
+				if response.Code == "timeout" {
+					finishStopped(b.t("query_timed_out", b.claudeTimeout))
+					outcome = "timed out"
+					return
+				}
+				if retry(response.Error) {
+					continue
+				}
+				outcome = fmt.Sprintf("error: %s", response.Error)
+				edit(b.t("query_error", response.Error))
 				return
 			}
 		}
 	}
 }
 
+// editText replaces a message's text. Telegram rejects edits that don't
+// change the message; those count as success rather than an error.
+func (b *Bot) editText(chatID int64, messageID int, text string) error {
+	_, err := b.api.Send(tgbotapi.NewEditMessageText(chatID, messageID, text))
+	if err != nil && strings.Contains(err.Error(), "message is not modified") {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Failed to edit message: %v", err)
+	}
+	return err
+}
+
+// wantsResponseFile reports whether a final response is long enough, by
+// either configured threshold, to be sent as a file
+func (b *Bot) wantsResponseFile(text string) bool {
+	if b.fileThreshold > 0 && utf8.RuneCountInString(text) > b.fileThreshold {
+		return true
+	}
+	return b.fileBytes > 0 && len(text) > b.fileBytes
+}
+
+// sendResponseFile sends text as a .md document and replaces the
+// streaming message with a short preview
+func (b *Bot) sendResponseFile(chatID int64, messageID int, text string) error {
+	tmpFile, err := os.CreateTemp("", "claude-response-*.md")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.WriteString(text); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(tmpFile.Name()))
+	if _, err := b.api.Send(doc); err != nil {
+		return fmt.Errorf("failed to send document: %w", err)
+	}
+
+	preview := truncateRunes(text, 500)
+	b.editText(chatID, messageID, b.t("response_attached", preview, utf8.RuneCountInString(text)))
+
+	return nil
+}
+
+// createSession creates a session in dir (creating the directory if needed)
+// and switches to it
+func (b *Bot) createSession(chatID int64, name, description, dir string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		b.api.Send(tgbotapi.NewMessage(chatID, b.t("mkdir_failed", err)))
+		return
+	}
+
+	newSession, err := b.sessionManager.Create(name, description, dir)
+	if err != nil {
+		b.api.Send(tgbotapi.NewMessage(chatID, b.t("error", err)))
+		return
+	}
+
+	b.setChatSession(chatID, newSession)
+
+	b.api.Send(tgbotapi.NewMessage(chatID, b.t("created_session",
+		name,
+		newSession.WorkingDir,
+	)))
+}
+
+// formatTimings renders the per-query footer, e.g. "⏱ 23.4s · 5 tool calls · 1.2k tokens"
+func (b *Bot) formatTimings(elapsed time.Duration, toolCalls, turns int) string {
+	footer := b.tn("timings", toolCalls, elapsed.Seconds())
+	if turns > 0 {
+		footer += " · " + b.tn("timings_turns", turns)
+	}
+	return footer
+}
+
+// formatUsage renders token usage and cost, e.g. "📊 1,203 in / 4,567 out · $0.021"
+func (b *Bot) formatUsage(inputTokens, outputTokens int, costUSD float64) string {
+	return b.t("usage_footer", formatThousands(inputTokens), formatThousands(outputTokens), costUSD)
+}
+
+// formatThousands formats n with comma thousands separators
+func formatThousands(n int) string {
+	s := strconv.Itoa(n)
+	if n < 0 {
+		return "-" + formatThousands(-n)
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
+
+// formatTokens abbreviates token counts above a thousand, e.g. 1234 -> "1.2k"
+func formatTokens(n int) string {
+	if n < 1000 {
+		return strconv.Itoa(n)
+	}
+	return fmt.Sprintf("%.1fk", float64(n)/1000)
+}
+
+// describeResultError turns an error result subtype into a user-facing message
+func (b *Bot) describeResultError(subtype string) string {
+	switch subtype {
+	case "error_max_turns":
+		return b.t("result_max_turns")
+	case "error_during_execution":
+		return b.t("result_execution_error")
+	case "":
+		return b.t("result_error")
+	default:
+		return b.t("result_error_subtype", subtype)
+	}
+}
+
+// acquireQuerySlot blocks until a concurrent query slot is available,
+// showing a queued notice while waiting. Returns false if ctx is cancelled.
+func (b *Bot) acquireQuerySlot(ctx context.Context, chatID int64, messageID int) bool {
+	if b.querySem == nil {
+		return true
+	}
+
+	select {
+	case b.querySem <- struct{}{}:
+		return true
+	default:
+	}
+
+	b.editText(chatID, messageID, b.t("queued"))
+
+	select {
+	case b.querySem <- struct{}{}:
+		b.editText(chatID, messageID, b.t("processing"))
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// releaseQuerySlot frees a slot taken by acquireQuerySlot
+func (b *Bot) releaseQuerySlot() {
+	if b.querySem != nil {
+		<-b.querySem
+	}
+}
+
+// getDefaultModel returns the model used when no profile sets one
+func (b *Bot) getDefaultModel() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.claudeModel
+}
+
+// setDefaultModel changes the model used when no profile sets one
+func (b *Bot) setDefaultModel(model string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.claudeModel = model
+}
+
+// isAuthorized reports whether userID may use the bot
+func (b *Bot) isAuthorized(userID int64) bool {
+	return b.authorizedUIDs[userID]
+}
+
+// isAdmin reports whether userID is the primary authorized user
+func (b *Bot) isAdmin(userID int64) bool {
+	return userID == b.adminUID
+}
+
+// audit records a handled message, command or callback in the audit log, if enabled
+func (b *Bot) audit(userID, chatID int64, kind, input, outcome string) {
+	if b.auditLog == nil {
+		return
+	}
+
+	entry := audit.Entry{
+		UserID:  userID,
+		ChatID:  chatID,
+		Kind:    kind,
+		Input:   input,
+		Outcome: outcome,
+	}
+	if err := b.auditLog.Log(entry); err != nil {
+		log.Printf("Warning: failed to write audit log: %v", err)
+	}
+}
+
+// normalizeTag lowercases a tag and strips a leading '#'
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(tag, "#"))
+}
+
+// hasAllTags reports whether the session carries every tag in tags
+func hasAllTags(s *session.Session, tags []string) bool {
+	for _, tag := range tags {
+		if !s.HasTag(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// historyMessageChars is how much of each message /history shows
+const historyMessageChars = 600
+
+// formatHistory renders transcript messages for /history, dropping the
+// oldest ones if the result is too long for a message
+func (b *Bot) formatHistory(sessionName string, messages []session.Message) string {
+	parts := make([]string, 0, len(messages))
+	for _, m := range messages {
+		icon := "👤"
+		if m.Role == "assistant" {
+			icon = "🤖"
+		}
+		text := m.Text
+		if len([]rune(text)) > historyMessageChars {
+			text = truncateRunes(text, historyMessageChars) + "…"
+		}
+		parts = append(parts, icon+" "+text)
+	}
+
+	header := b.tn("history_header", len(messages), sessionName) + "\n\n"
+	body := strings.Join(parts, "\n\n")
+	if telegramLen(header+body) > telegramLimit {
+		body = "…\n\n" + tailTelegram(body, telegramLimit-telegramLen(header)-3)
+	}
+	return header + body
+}
+
+// formatTags renders tags as "#a #b", or "none"
+func (b *Bot) formatTags(tags []string) string {
+	if len(tags) == 0 {
+		return b.t("none")
+	}
+	return "#" + strings.Join(tags, " #")
+}
+
+// sortSessions orders sessions in place by the given key, pinned sessions
+// first. Ties fall back to name so the listing is stable.
+func sortSessions(sessions []*session.Session, key string, sizes map[string]int64) {
+	sort.SliceStable(sessions, func(i, j int) bool {
+		a, b := sessions[i], sessions[j]
+		if a.Pinned != b.Pinned {
+			return a.Pinned
+		}
+		switch key {
+		case "created":
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.After(b.CreatedAt)
+			}
+		case "size":
+			if sizes[a.Name] != sizes[b.Name] {
+				return sizes[a.Name] > sizes[b.Name]
+			}
+		case "recent":
+			if !a.LastUsedAt.Equal(b.LastUsedAt) {
+				return a.LastUsedAt.After(b.LastUsedAt)
+			}
+		}
+		return a.Name < b.Name
+	})
+}
+
+// pluralSuffix picks the singular or plural suffix for count
+func pluralSuffix(count int, singular, plural string) string {
+	if count == 1 {
+		return singular
+	}
+	return plural
+}
+
+// formatSize renders a byte count in human readable form
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// telegramLimit is the longest message text sent, leaving headroom under
+// Telegram's 4096 limit
+const telegramLimit = 4000
+
+// telegramLen returns the length of s as Telegram counts it: in UTF-16 code
+// units, so characters outside the BMP (most emoji) count twice
+func telegramLen(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16Len(r)
+	}
+	return n
+}
+
+// truncateTelegram shortens s to at most n UTF-16 code units without
+// splitting a character
+func truncateTelegram(s string, n int) string {
+	units := 0
+	for i, r := range s {
+		units += utf16Len(r)
+		if units > n {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// tailTelegram returns the last n UTF-16 code units of s without splitting
+// a character
+func tailTelegram(s string, n int) string {
+	units := 0
+	for i := len(s); i > 0; {
+		r, size := utf8.DecodeLastRuneInString(s[:i])
+		units += utf16Len(r)
+		if units > n {
+			return s[i:]
+		}
+		i -= size
+	}
+	return s
+}
+
+// utf16Len returns the number of UTF-16 code units needed to encode r
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// truncateRunes shortens s to at most n runes without splitting a character
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+// sanitizeDirName turns a session name into a safe directory name
+func sanitizeDirName(name string) string {
+	var sb strings.Builder
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.' {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteRune('-')
+		}
+	}
+
+	dirName := strings.Trim(sb.String(), ".")
+	if dirName == "" {
+		dirName = "session"
+	}
+	return dirName
+}
+
+// sessionsRoot returns the directory new sessions are created in: the
+// workspace root, or /workspace when the root is "/" (sandbox disabled)
+func sessionsRoot(workspaceRoot string) string {
+	if filepath.Clean(workspaceRoot) == "/" {
+		return "/workspace"
+	}
+	return workspaceRoot
+}
+
+// dirNonEmpty reports whether dir exists and contains at least one entry
+func dirNonEmpty(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	return err == nil && len(entries) > 0
+}
+
 // cleanPath resolves relative path components (.. and .)
 func cleanPath(path string) string {
 	// Split path into components
@@ -550,43 +2362,281 @@ func cleanPath(path string) string {
 	return "/" + strings.Join(cleaned, "/")
 }
 
-// LoadConfigFromEnv loads configuration from environment variables
+// LoadConfigFromEnv loads configuration from environment variables, with
+// an optional JSON file (OMNI_CONFIG_FILE) supplying values for unset ones
 func LoadConfigFromEnv() (Config, error) {
-	token := os.Getenv("TELEGRAM_BOT_TOKEN")
+	src, err := loadConfigSource()
+	if err != nil {
+		return Config{}, err
+	}
+
+	token := src.get("TELEGRAM_BOT_TOKEN")
 	if token == "" {
 		return Config{}, fmt.Errorf("TELEGRAM_BOT_TOKEN not set")
 	}
 
-	uidStr := os.Getenv("AUTHORIZED_USER_ID")
+	uidStr := src.get("AUTHORIZED_USER_ID")
 	if uidStr == "" {
 		return Config{}, fmt.Errorf("AUTHORIZED_USER_ID not set")
 	}
 
-	uid, err := strconv.ParseInt(uidStr, 10, 64)
-	if err != nil {
-		return Config{}, fmt.Errorf("invalid AUTHORIZED_USER_ID: %w", err)
+	// Comma-separated; the first user is the admin
+	var uids []int64
+	for _, field := range strings.Split(uidStr, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		uid, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid AUTHORIZED_USER_ID: %w", err)
+		}
+		uids = append(uids, uid)
+	}
+	if len(uids) == 0 {
+		return Config{}, fmt.Errorf("AUTHORIZED_USER_ID not set")
 	}
 
-	// Check if using SDK mode
-	useSDK := os.Getenv("USE_CLAUDE_SDK") == "true"
+	// Claude client; USE_CLAUDE_SDK=true is the old way of selecting the CLI
+	claudeClient := src.get("OMNI_CLIENT")
+	if claudeClient == "" {
+		claudeClient = "http"
+		if src.get("USE_CLAUDE_SDK") == "true" {
+			claudeClient = "cli"
+		}
+	}
+	if claudeClient != "cli" && claudeClient != "http" {
+		return Config{}, fmt.Errorf("invalid OMNI_CLIENT: %s (must be cli or http)", claudeClient)
+	}
 
 	// Model configuration
-	model := os.Getenv("CLAUDE_MODEL")
+	model := src.get("CLAUDE_MODEL")
 	if model == "" {
 		model = "sonnet" // Default to sonnet
 	}
 
 	// Bridge URL for HTTP mode
-	bridgeURL := os.Getenv("CLAUDE_BRIDGE_URL")
+	bridgeURL := src.get("CLAUDE_BRIDGE_URL")
 	if bridgeURL == "" {
 		bridgeURL = "http://claude-bridge:9000"
 	}
 
+	// Optional audit log path
+	auditLogPath := src.get("OMNI_AUDIT_LOG")
+
+	// Concurrent query limit (0 = unlimited)
+	maxQueries := 3
+	if v := src.get("OMNI_MAX_CONCURRENT_QUERIES"); v != "" {
+		maxQueries, err = strconv.Atoi(v)
+		if err != nil || maxQueries < 0 {
+			return Config{}, fmt.Errorf("invalid OMNI_MAX_CONCURRENT_QUERIES: %s", v)
+		}
+	}
+
+	// Prompts queued behind a chat's running query (0 = reject instead)
+	queueDepth := 3
+	if v := src.get("OMNI_QUEUE_DEPTH"); v != "" {
+		queueDepth, err = strconv.Atoi(v)
+		if err != nil || queueDepth < 0 {
+			return Config{}, fmt.Errorf("invalid OMNI_QUEUE_DEPTH: %s", v)
+		}
+	}
+
+	// Opt-in: responses longer than this many characters are sent as a file
+	fileThreshold := 0
+	if v := src.get("OMNI_RESPONSE_FILE_THRESHOLD"); v != "" {
+		fileThreshold, err = strconv.Atoi(v)
+		if err != nil || fileThreshold < 0 {
+			return Config{}, fmt.Errorf("invalid OMNI_RESPONSE_FILE_THRESHOLD: %s", v)
+		}
+	}
+
+	// Opt-in: responses larger than this many bytes are sent as a file
+	fileBytes := 0
+	if v := src.get("OMNI_LONG_REPLY_AS_FILE_BYTES"); v != "" {
+		fileBytes, err = strconv.Atoi(v)
+		if err != nil || fileBytes < 0 {
+			return Config{}, fmt.Errorf("invalid OMNI_LONG_REPLY_AS_FILE_BYTES: %s", v)
+		}
+	}
+
+	// Optional allowlist of binaries for /exec; OMNI_EXEC_ALLOW is accepted
+	// as a shorter name
+	allowlist := src.get("OMNI_EXEC_ALLOWLIST")
+	if allowlist == "" {
+		allowlist = src.get("OMNI_EXEC_ALLOW")
+	}
+	var execAllowlist []string
+	for _, name := range strings.Split(allowlist, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			execAllowlist = append(execAllowlist, name)
+		}
+	}
+
+	// Optional denylist of command prefixes for /exec
+	var execDenylist []string
+	for _, prefix := range strings.Split(src.get("OMNI_EXEC_DENY"), ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			execDenylist = append(execDenylist, prefix)
+		}
+	}
+
+	// Bootstrap session created when no sessions exist
+	defaultSessionName := src.get("OMNI_DEFAULT_SESSION_NAME")
+	if defaultSessionName == "" {
+		defaultSessionName = "default"
+	}
+
+	// File commands may not leave the workspace ("/" allows everything)
+	workspaceRoot := src.get("OMNI_WORKSPACE_ROOT")
+	if workspaceRoot == "" {
+		workspaceRoot = "/workspace"
+	}
+	if !strings.HasPrefix(workspaceRoot, "/") {
+		return Config{}, fmt.Errorf("invalid OMNI_WORKSPACE_ROOT: %s (must be absolute)", workspaceRoot)
+	}
+
+	// The first-run session lives in the workspace unless configured
+	defaultSessionDir := src.get("OMNI_DEFAULT_SESSION_DIR")
+	if defaultSessionDir == "" {
+		defaultSessionDir = sessionsRoot(workspaceRoot)
+	}
+
+	// Prompt length limit
+	maxPromptChars := 100000
+	if v := src.get("OMNI_MAX_PROMPT_CHARS"); v != "" {
+		maxPromptChars, err = strconv.Atoi(v)
+		if err != nil || maxPromptChars < 0 {
+			return Config{}, fmt.Errorf("invalid OMNI_MAX_PROMPT_CHARS: %s", v)
+		}
+	}
+
+	// Whole-query retries on transient failures
+	queryRetries := 1
+	if v := src.get("OMNI_QUERY_RETRIES"); v != "" {
+		queryRetries, err = strconv.Atoi(v)
+		if err != nil || queryRetries < 0 {
+			return Config{}, fmt.Errorf("invalid OMNI_QUERY_RETRIES: %s", v)
+		}
+	}
+
+	// Runaway queries are killed after this long
+	claudeTimeout := 30 * time.Minute
+	if v := src.get("OMNI_CLAUDE_TIMEOUT"); v != "" {
+		claudeTimeout, err = time.ParseDuration(v)
+		if err != nil || claudeTimeout < 0 {
+			return Config{}, fmt.Errorf("invalid OMNI_CLAUDE_TIMEOUT: %s", v)
+		}
+	}
+
+	// Longest an /exec command may run before it is killed
+	execTimeout := 10 * time.Minute
+	if v := src.get("OMNI_EXEC_TIMEOUT"); v != "" {
+		execTimeout, err = time.ParseDuration(v)
+		if err != nil || execTimeout < 0 {
+			return Config{}, fmt.Errorf("invalid OMNI_EXEC_TIMEOUT: %s", v)
+		}
+	}
+
+	// Opt-in fresh conversation once a transcript gets this large
+	autoReloadMB := 0
+	if v := src.get("OMNI_AUTO_RELOAD_MB"); v != "" {
+		autoReloadMB, err = strconv.Atoi(v)
+		if err != nil || autoReloadMB < 0 {
+			return Config{}, fmt.Errorf("invalid OMNI_AUTO_RELOAD_MB: %s", v)
+		}
+	}
+
+	// Largest file /download saves into the workspace
+	downloadMaxMB := 100
+	if v := src.get("OMNI_DOWNLOAD_MAX_MB"); v != "" {
+		downloadMaxMB, err = strconv.Atoi(v)
+		if err != nil || downloadMaxMB <= 0 {
+			return Config{}, fmt.Errorf("invalid OMNI_DOWNLOAD_MAX_MB: %s", v)
+		}
+	}
+
+	// Longest stream-json line accepted from the Claude CLI
+	maxLineMB := 0
+	if v := src.get("OMNI_MAX_LINE_MB"); v != "" {
+		maxLineMB, err = strconv.Atoi(v)
+		if err != nil || maxLineMB <= 0 {
+			return Config{}, fmt.Errorf("invalid OMNI_MAX_LINE_MB: %s", v)
+		}
+	}
+
+	// Estimated prompt cost above which expensive models ask first
+	confirmCostUSD := 0.10
+	if v := src.get("OMNI_CONFIRM_COST_USD"); v != "" {
+		confirmCostUSD, err = strconv.ParseFloat(v, 64)
+		if err != nil || confirmCostUSD < 0 {
+			return Config{}, fmt.Errorf("invalid OMNI_CONFIRM_COST_USD: %s", v)
+		}
+	}
+
+	// Optional read-only chat mirroring completed queries
+	var observerChatID int64
+	if v := src.get("OMNI_OBSERVER_CHAT_ID"); v != "" {
+		observerChatID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid OMNI_OBSERVER_CHAT_ID: %s", v)
+		}
+	}
+
+	// Optional command aliases as a JSON object, e.g. {"ll":"ls"}
+	var aliases map[string]string
+	if v := src.get("OMNI_COMMAND_ALIASES"); v != "" {
+		if err := json.Unmarshal([]byte(v), &aliases); err != nil {
+			return Config{}, fmt.Errorf("invalid OMNI_COMMAND_ALIASES: %w", err)
+		}
+		for alias, command := range aliases {
+			aliases[alias] = strings.TrimPrefix(command, "/")
+		}
+	}
+
+	// Model sent to an OMNI_STT_URL transcription endpoint
+	sttModel := src.get("OMNI_STT_MODEL")
+	if sttModel == "" {
+		sttModel = "whisper-1"
+	}
+
 	return Config{
-		TelegramToken:   token,
-		AuthorizedUID:   uid,
-		ClaudeBridgeURL: bridgeURL,
-		UseSDK:          useSDK,
-		ClaudeModel:     model,
+		TelegramToken:    token,
+		AuthorizedUIDs:   uids,
+		ClaudeBridgeURL:  bridgeURL,
+		ClaudeClient:     claudeClient,
+		ClaudeModel:      model,
+		AuditLogPath:     auditLogPath,
+		MaxQueries:       maxQueries,
+		FileThreshold:    fileThreshold,
+		FileBytes:        fileBytes,
+		CommandAliases:   aliases,
+		ExecAllowlist:    execAllowlist,
+		ExecDenylist:     execDenylist,
+		WorkspaceRoot:    workspaceRoot,
+		ShowTimings:      src.get("OMNI_SHOW_TIMINGS") == "true",
+		SendImages:       src.get("OMNI_SEND_IMAGES") == "true",
+		MaxPromptChars:   maxPromptChars,
+		ProfilesFile:     src.get("OMNI_PROFILES_FILE"),
+		LogFile:          src.get("OMNI_LOG_FILE"),
+		QueryRetries:     queryRetries,
+		ClaudeTimeout:    claudeTimeout,
+		ExecTimeout:      execTimeout,
+		AutoReloadMB:     autoReloadMB,
+		DownloadMaxMB:    downloadMaxMB,
+		Lang:             src.get("OMNI_LANG"),
+		MaxLineSize:      maxLineMB * 1024 * 1024,
+		ConfirmExpensive: src.get("OMNI_CONFIRM_EXPENSIVE") == "true",
+		ConfirmCostUSD:   confirmCostUSD,
+		ConfigFile:       os.Getenv("OMNI_CONFIG_FILE"),
+		ObserverChatID:   observerChatID,
+		QueueDepth:       queueDepth,
+		STTURL:           src.get("OMNI_STT_URL"),
+		STTAPIKey:        src.get("OMNI_STT_API_KEY"),
+		STTModel:         sttModel,
+		STTCommand:       src.get("OMNI_STT_COMMAND"),
+
+		DefaultSessionName: defaultSessionName,
+		DefaultSessionDir:  defaultSessionDir,
 	}, nil
 }
@@ -0,0 +1,335 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+
+	"github.com/drew/omnik-bot/internal/claude"
+	"github.com/drew/omnik-bot/internal/session"
+)
+
+// fakeTelegram is a Telegram Bot API server that records the text of
+// every message sent or edited
+type fakeTelegram struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+
+	result := `{"message_id":1,"date":0,"chat":{"id":1}}`
+	switch method {
+	case "getMe":
+		result = `{"id":1,"is_bot":true,"first_name":"omnik","username":"omnik_bot"}`
+	case "sendMessage", "editMessageText":
+		f.mu.Lock()
+		f.texts = append(f.texts, r.Form.Get("text"))
+		f.mu.Unlock()
+	}
+	fmt.Fprintf(w, `{"ok":true,"result":%s}`, result)
+}
+
+// lastText returns the text of the last message sent or edited
+func (f *fakeTelegram) lastText() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.texts) == 0 {
+		return ""
+	}
+	return f.texts[len(f.texts)-1]
+}
+
+// fakeClient is a claude.QueryClient that replays canned responses
+type fakeClient struct {
+	responses []claude.StreamResponse
+}
+
+func (c *fakeClient) Query(ctx context.Context, req claude.QueryRequest) (<-chan claude.StreamResponse, <-chan error) {
+	responseChan := make(chan claude.StreamResponse, len(c.responses))
+	errorChan := make(chan error, 1)
+	for _, response := range c.responses {
+		responseChan <- response
+	}
+	close(responseChan)
+	close(errorChan)
+	return responseChan, errorChan
+}
+
+func (c *fakeClient) Health(ctx context.Context) error {
+	return nil
+}
+
+// newTestBot returns a bot talking to a fake Telegram server and client,
+// with one session
+func newTestBot(t *testing.T, client claude.QueryClient) (*Bot, *fakeTelegram) {
+	t.Helper()
+
+	telegram := &fakeTelegram{}
+	server := httptest.NewServer(telegram)
+	t.Cleanup(server.Close)
+
+	api, err := tgbotapi.NewBotAPIWithAPIEndpoint("token", server.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	sessions, err := session.NewManager(filepath.Join(dir, "sessions.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sessions.Create("test", "", dir); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := loadCatalog("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &Bot{
+		api:            api,
+		claudeClient:   client,
+		sessionManager: sessions,
+		workingDir:     dir,
+		workspaceRoot:  dir,
+		stopChannels:   make(map[int64]*runningQuery),
+		runningExecs:   make(map[int64]*runningQuery),
+		queuedPrompts:  make(map[int64][]queuedPrompt),
+		profiles:       builtinProfiles,
+		chatProfiles:   make(map[int64]string),
+		chatModels:     make(map[int64]string),
+		chatSessions:   make(map[int64]string),
+		chatDirs:       make(map[int64]string),
+		messages:       messages,
+		pendingPerms:   make(map[string]pendingPermission),
+		health:         healthStatus{Healthy: true},
+	}
+	return b, telegram
+}
+
+// assistantText returns a claude_message carrying an assistant text block
+func assistantText(t *testing.T, text string) claude.StreamResponse {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]interface{}{
+		"type": "assistant",
+		"message": map[string]interface{}{
+			"content": []interface{}{map[string]interface{}{"type": "text", "text": text}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claude.StreamResponse{Type: "claude_message", Data: data}
+}
+
+func TestForwardToClaudeChannelClosedWithoutDone(t *testing.T) {
+	msg := &tgbotapi.Message{
+		MessageID: 1,
+		From:      &tgbotapi.User{ID: 42},
+		Chat:      &tgbotapi.Chat{ID: 42},
+		Text:      "hi",
+	}
+
+	t.Run("partial response", func(t *testing.T) {
+		// Both chunks arrive within one rate-limited edit window
+		b, telegram := newTestBot(t, &fakeClient{responses: []claude.StreamResponse{
+			assistantText(t, "first half, "),
+			assistantText(t, "second half"),
+		}})
+		b.forwardToClaude(context.Background(), msg, "hi")
+
+		if got, want := telegram.lastText(), "first half, second half"; got != want {
+			t.Errorf("final message = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("no response", func(t *testing.T) {
+		b, telegram := newTestBot(t, &fakeClient{})
+		b.forwardToClaude(context.Background(), msg, "hi")
+
+		if got, want := telegram.lastText(), b.t("closed_no_output"); got != want {
+			t.Errorf("final message = %q, want %q", got, want)
+		}
+	})
+}
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		errText string
+		want    bool
+	}{
+		{"API Error: 529 {\"type\":\"overloaded_error\"}", true},
+		{"API Error: 429 rate limit exceeded", true},
+		{"API Error: 503 Service Unavailable", true},
+		{"Overloaded", true},
+		{"read tcp 10.0.0.1:443: connection reset by peer", true},
+		{"dial tcp: connection refused", true},
+		{"unexpected EOF", true},
+		{"claude exited without output", true},
+		{"claude exited with code 1:\nError: invalid model: gpt-4", false},
+		{"failed to parse response: invalid character '}' looking for beginning of value", false},
+		{"session not found", false},
+		{"API Error: 401 invalid x-api-key", false},
+		{"query timed out after 30m0s", false},
+		{"context canceled", false},
+	}
+
+	for _, tt := range tests {
+		if got := isTransientError(tt.errText); got != tt.want {
+			t.Errorf("isTransientError(%q) = %v, want %v", tt.errText, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateTelegramSurrogatePairs(t *testing.T) {
+	// 😀 is outside the BMP, so Telegram counts it as two UTF-16 units
+	tests := []struct {
+		name string
+		s    string
+		n    int
+		want string
+	}{
+		{"fits", "ab😀", 4, "ab😀"},
+		{"limit inside pair", "ab😀cd", 3, "ab"},
+		{"limit after pair", "ab😀cd", 4, "ab😀"},
+		{"only emoji", "😀😀😀", 5, "😀😀"},
+		{"zero", "😀", 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateTelegram(tt.s, tt.n); got != tt.want {
+				t.Errorf("truncateTelegram(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTailTelegramSurrogatePairs(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"ab😀cd", 3, "cd"},
+		{"ab😀cd", 4, "😀cd"},
+		{"😀😀😀", 5, "😀😀"},
+	}
+
+	for _, tt := range tests {
+		if got := tailTelegram(tt.s, tt.n); got != tt.want {
+			t.Errorf("tailTelegram(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSplitTelegramSurrogatePairs(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		n    int
+		want []string
+	}{
+		{"boundary inside pair", "abc😀def", 4, []string{"abc", "😀de", "f"}},
+		{"all emoji odd limit", "😀😀😀", 3, []string{"😀", "😀", "😀"}},
+		{"prefers newline", "a\n😀😀", 4, []string{"a\n", "😀😀"}},
+		{"fits", "😀", 2, []string{"😀"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitTelegram(tt.s, tt.n)
+			if len(got) != len(tt.want) {
+				t.Fatalf("splitTelegram(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("splitTelegram(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+				}
+				if !utf8.ValidString(got[i]) || telegramLen(got[i]) > tt.n {
+					t.Errorf("chunk %q is invalid or longer than %d units", got[i], tt.n)
+				}
+			}
+		})
+	}
+}
+
+func TestExecRejectionsUseCatalogKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantKey string
+	}{
+		{"shell operators", checkExecAllowed("ls; reboot", []string{"ls"}), "exec_shell_operators"},
+		{"not allowlisted", checkExecAllowed("rm -rf x", []string{"ls"}), "exec_not_allowed"},
+		{"denied", checkExecDenied("sudo reboot", []string{"reboot"}), "exec_denied"},
+	}
+
+	for _, tt := range tests {
+		var rejected *execRejectedError
+		if !errors.As(tt.err, &rejected) {
+			t.Errorf("%s: error %v is not an execRejectedError", tt.name, tt.err)
+			continue
+		}
+		if rejected.Key != tt.wantKey {
+			t.Errorf("%s: key = %q, want %q", tt.name, rejected.Key, tt.wantKey)
+		}
+	}
+
+	if err := checkExecAllowed("ls -la", []string{"ls"}); err != nil {
+		t.Errorf("allowlisted command rejected: %v", err)
+	}
+}
+
+func TestSplitTelegramRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+	}{
+		{"empty", ""},
+		{"short", "hello"},
+		{"exactly the limit", strings.Repeat("a", telegramLimit)},
+		{"one past the limit", strings.Repeat("a", telegramLimit+1)},
+		{"ascii", strings.Repeat("lorem ipsum ", 1500)},
+		{"multibyte", strings.Repeat("ñandú café ", 1200)},
+		{"cjk", strings.Repeat("日本語のテキスト", 1100)},
+		{"emoji", strings.Repeat("😀", telegramLimit)},
+		{"emoji after odd prefix", "x" + strings.Repeat("👍🏽", 2500)},
+		{"newline at boundary", strings.Repeat("a", telegramLimit-1) + "\n" + strings.Repeat("b", 10)},
+		{"many lines", strings.Repeat("line of output\n", 800)},
+		{"newlines only", strings.Repeat("\n", telegramLimit*2+3)},
+		{"long lines", strings.Repeat(strings.Repeat("z", telegramLimit+50)+"\n", 3)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := splitTelegram(tt.s, telegramLimit)
+			if got := strings.Join(chunks, ""); got != tt.s {
+				t.Fatalf("chunks join to %d bytes, want the %d byte input", len(got), len(tt.s))
+			}
+			for i, chunk := range chunks {
+				if n := telegramLen(chunk); n > telegramLimit {
+					t.Errorf("chunk %d is %d UTF-16 units, limit %d", i, n, telegramLimit)
+				}
+				if !utf8.ValidString(chunk) {
+					t.Errorf("chunk %d splits a character", i)
+				}
+			}
+		})
+	}
+}
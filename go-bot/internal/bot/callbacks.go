@@ -0,0 +1,119 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// pendingConfirm is an action waiting for the user to tap Confirm or Cancel
+type pendingConfirm struct {
+	chatID    int64
+	onConfirm func()
+}
+
+// askConfirm sends text with an inline Confirm/Cancel keyboard and runs
+// onConfirm if the user confirms
+func (b *Bot) askConfirm(chatID int64, text, confirmLabel string, onConfirm func()) {
+	b.confirmMu.Lock()
+	b.confirmSeq++
+	id := fmt.Sprintf("%d", b.confirmSeq)
+	b.pendingConfirms[id] = pendingConfirm{chatID: chatID, onConfirm: onConfirm}
+	b.confirmMu.Unlock()
+
+	reply := tgbotapi.NewMessage(chatID, text)
+	reply.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(confirmLabel, "confirm:"+id),
+			tgbotapi.NewInlineKeyboardButtonData(b.t("button_cancel"), "cancel:"+id),
+		),
+	)
+	if _, err := b.api.Send(reply); err != nil {
+		log.Printf("Failed to send confirmation: %v", err)
+		b.confirmMu.Lock()
+		delete(b.pendingConfirms, id)
+		b.confirmMu.Unlock()
+	}
+}
+
+// takeConfirm removes and returns the pending confirmation with the given ID
+func (b *Bot) takeConfirm(id string, chatID int64) (pendingConfirm, bool) {
+	b.confirmMu.Lock()
+	defer b.confirmMu.Unlock()
+
+	pending, ok := b.pendingConfirms[id]
+	if !ok || pending.chatID != chatID {
+		return pendingConfirm{}, false
+	}
+	delete(b.pendingConfirms, id)
+	return pending, true
+}
+
+// handleCallbackQuery processes inline keyboard button presses
+func (b *Bot) handleCallbackQuery(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	if query.Message == nil {
+		return
+	}
+	chatID := query.Message.Chat.ID
+	messageID := query.Message.MessageID
+
+	// Check authorization
+	if !b.isAuthorized(query.From.ID) {
+		log.Printf("Unauthorized callback from user %d", query.From.ID)
+		b.audit(query.From.ID, chatID, "callback", query.Data, "unauthorized")
+		b.api.Request(tgbotapi.NewCallback(query.ID, b.t("unauthorized")))
+		return
+	}
+
+	outcome := "handled"
+	defer func() { b.audit(query.From.ID, chatID, "callback", query.Data, outcome) }()
+
+	// Acknowledge the button press so the client stops its spinner
+	b.api.Request(tgbotapi.NewCallback(query.ID, ""))
+
+	action, id, _ := strings.Cut(query.Data, ":")
+	switch action {
+	case "confirm", "cancel":
+		pending, ok := b.takeConfirm(id, chatID)
+		if !ok {
+			outcome = "expired"
+			b.api.Send(tgbotapi.NewEditMessageText(chatID, messageID, b.t("confirm_expired")))
+			return
+		}
+
+		if action == "cancel" {
+			outcome = "cancelled"
+			b.api.Send(tgbotapi.NewEditMessageText(chatID, messageID, b.t("cancelled")))
+			return
+		}
+
+		// Drop the keyboard, keep the original question for context
+		b.api.Send(tgbotapi.NewEditMessageText(chatID, messageID, query.Message.Text+"\n\n"+b.t("confirmed")))
+		pending.onConfirm()
+
+	case "perm_allow", "perm_deny":
+		pending, ok := b.takePermission(id, chatID)
+		if !ok {
+			outcome = "expired"
+			b.api.Send(tgbotapi.NewEditMessageText(chatID, messageID, query.Message.Text+"\n\n"+b.t("permission_expired")))
+			return
+		}
+
+		allow := action == "perm_allow"
+		pending.decision <- allow
+		if allow {
+			outcome = "allowed"
+			b.api.Send(tgbotapi.NewEditMessageText(chatID, messageID, query.Message.Text+"\n\n"+b.t("permission_allowed")))
+		} else {
+			outcome = "denied"
+			b.api.Send(tgbotapi.NewEditMessageText(chatID, messageID, query.Message.Text+"\n\n"+b.t("permission_denied")))
+		}
+
+	default:
+		outcome = "unknown action"
+		log.Printf("Unknown callback data: %s", query.Data)
+	}
+}
@@ -0,0 +1,152 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/drew/omnik-bot/internal/fsutil"
+	"github.com/drew/omnik-bot/internal/session"
+)
+
+// chatStatePath is where per-chat choices survive restarts
+const chatStatePath = "/workspace/.omnik-chats.json"
+
+// chatState is a chat's persisted /profile, /model, session and working
+// directory choices
+type chatState struct {
+	Profile    string `json:"profile,omitempty"`
+	Model      string `json:"model,omitempty"`
+	Session    string `json:"session,omitempty"`
+	WorkingDir string `json:"working_dir,omitempty"`
+}
+
+// loadChatState reads the per-chat choices saved at path. A missing file
+// means no chat has made any.
+func loadChatState(path string) (map[int64]chatState, error) {
+	states := make(map[int64]chatState)
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return states, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read chat state: %w", err)
+	}
+
+	var stored map[string]chatState
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse chat state %s: %w", path, err)
+	}
+	for key, state := range stored {
+		chatID, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			log.Printf("Ignoring chat state for invalid chat ID %q", key)
+			continue
+		}
+		states[chatID] = state
+	}
+	return states, nil
+}
+
+// saveChatState writes the per-chat choices. Caller must hold chatMu.
+func (b *Bot) saveChatState() {
+	states := make(map[string]chatState)
+	update := func(chatID int64, set func(*chatState)) {
+		key := strconv.FormatInt(chatID, 10)
+		state := states[key]
+		set(&state)
+		states[key] = state
+	}
+	for chatID, profile := range b.chatProfiles {
+		update(chatID, func(s *chatState) { s.Profile = profile })
+	}
+	for chatID, model := range b.chatModels {
+		update(chatID, func(s *chatState) { s.Model = model })
+	}
+	for chatID, name := range b.chatSessions {
+		update(chatID, func(s *chatState) { s.Session = name })
+	}
+	for chatID, dir := range b.chatDirs {
+		update(chatID, func(s *chatState) { s.WorkingDir = dir })
+	}
+
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err == nil {
+		err = fsutil.WriteFileAtomic(chatStatePath, data, 0644)
+	}
+	if err != nil {
+		log.Printf("Warning: failed to save chat state: %v", err)
+	}
+}
+
+// currentSession returns the chat's session: the one it last switched to,
+// or else the session most recently selected in any chat
+func (b *Bot) currentSession(chatID int64) *session.Session {
+	b.chatMu.RLock()
+	name, ok := b.chatSessions[chatID]
+	b.chatMu.RUnlock()
+
+	if ok {
+		if s, err := b.sessionManager.Get(name); err == nil {
+			return s
+		}
+	}
+	return b.sessionManager.Current()
+}
+
+// setChatSession makes s the chat's session and moves the chat to its
+// working directory
+func (b *Bot) setChatSession(chatID int64, s *session.Session) {
+	b.chatMu.Lock()
+	defer b.chatMu.Unlock()
+
+	b.chatSessions[chatID] = s.Name
+	b.chatDirs[chatID] = s.WorkingDir
+	b.saveChatState()
+}
+
+// forgetSession drops a deleted session from every chat using it, so those
+// chats fall back to the current session and its directory
+func (b *Bot) forgetSession(name string) {
+	b.chatMu.Lock()
+	defer b.chatMu.Unlock()
+
+	changed := false
+	for chatID, sessionName := range b.chatSessions {
+		if sessionName == name {
+			delete(b.chatSessions, chatID)
+			delete(b.chatDirs, chatID)
+			changed = true
+		}
+	}
+	if changed {
+		b.saveChatState()
+	}
+}
+
+// getWorkingDir returns the chat's working directory: the one it last
+// moved to, or else its session's
+func (b *Bot) getWorkingDir(chatID int64) string {
+	b.chatMu.RLock()
+	dir, ok := b.chatDirs[chatID]
+	b.chatMu.RUnlock()
+
+	if ok {
+		return dir
+	}
+	if s := b.currentSession(chatID); s != nil {
+		return s.WorkingDir
+	}
+	return b.workingDir
+}
+
+// setWorkingDir changes the chat's working directory
+func (b *Bot) setWorkingDir(chatID int64, dir string) {
+	b.chatMu.Lock()
+	defer b.chatMu.Unlock()
+
+	b.chatDirs[chatID] = dir
+	b.saveChatState()
+}
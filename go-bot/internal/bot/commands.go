@@ -0,0 +1,229 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// commandSection groups commands in /start and /help
+type commandSection struct {
+	key   string
+	title string
+}
+
+// commandSections lists the sections in display order
+var commandSections = []commandSection{
+	{"claude", "Claude"},
+	{"files", "File Navigation"},
+	{"sessions", "Session Management"},
+	{"automation", "Automation"},
+	{"admin", "Admin"},
+	{"help", "Help"},
+}
+
+// commandInfo describes a command for /start, /help and Telegram's
+// command menu. Descriptions are English; catalogs may override them with
+// a "cmd.<name>" key.
+type commandInfo struct {
+	Name        string
+	Args        string
+	Section     string
+	Description string
+	Details     string // Extra explanation shown by /help <command>
+	Examples    []string
+}
+
+// commands is the table of every command the bot understands
+var commands = []commandInfo{
+	{Name: "raw", Args: "<text>", Section: "claude", Description: "Send text to Claude as-is (e.g. starting with /)",
+		Examples: []string{"/raw /compact"}},
+	{Name: "stop", Args: "[all]", Section: "claude", Description: "Stop the running query in this chat",
+		Details: "Prompts sent while a query runs wait in a queue and start once it finishes. /stop all also drops the queue."},
+	{Name: "profile", Args: "[name]", Section: "claude", Description: "Switch model/permission/tools profile",
+		Details:  "Without a name, shows the active profile and lists the others. /profile none returns to the bot defaults.",
+		Examples: []string{"/profile safe", "/profile none"}},
+	{Name: "model", Args: "[sonnet|opus|haiku|default]", Section: "claude", Description: "Show or change this chat's model",
+		Details:  "The chosen model overrides the profile's model and the bot default. /model default removes the override.",
+		Examples: []string{"/model opus", "/model default"}},
+
+	{Name: "pwd", Section: "files", Description: "Show current working directory"},
+	{Name: "ls", Section: "files", Description: "List files (ls -lah)"},
+	{Name: "cd", Args: "<path>", Section: "files", Description: "Change directory",
+		Examples: []string{"/cd src", "/cd /workspace/api"}},
+	{Name: "cat", Args: "<file> [start:end]", Section: "files", Description: "Show file contents",
+		Details:  "Either side of the line range may be left out.",
+		Examples: []string{"/cat main.go", "/cat main.go 10:40", "/cat README.md :20"}},
+	{Name: "info", Args: "<file>", Section: "files", Description: "Show file size, mode and type"},
+	{Name: "du", Args: "[path]", Section: "files", Description: "Show disk usage and largest entries"},
+	{Name: "recent", Args: "[n]", Section: "files", Description: "List the most recently modified files",
+		Examples: []string{"/recent", "/recent 25"}},
+	{Name: "rm", Args: "[-r] <path>", Section: "files", Description: "Delete a file after confirming",
+		Details: "Directories need -r. Paths are relative to the working directory and can't leave the workspace."},
+	{Name: "mv", Args: "[-r] <src> <dst>", Section: "files", Description: "Move or rename a file",
+		Details:  "If dst is an existing directory, src is moved into it. Directories need -r.",
+		Examples: []string{"/mv notes.md docs/", "/mv -r old-dir new-dir"}},
+	{Name: "cp", Args: "[-r] <src> <dst>", Section: "files", Description: "Copy a file",
+		Details: "If dst is an existing directory, src is copied into it. Directories need -r."},
+	{Name: "download", Args: "<url> [filename]", Section: "files", Description: "Save a URL into the working directory",
+		Details:  "Only http and https URLs are accepted. The file name defaults to the last part of the URL path, and existing files are never overwritten.",
+		Examples: []string{"/download https://example.com/data.csv", "/download https://example.com/export?id=1 export.json"}},
+	{Name: "exec", Args: "<cmd>", Section: "files", Description: "Execute bash command",
+		Details:  "When OMNI_EXEC_ALLOWLIST is set, only those binaries may run and shell operators are rejected. Commands starting with an OMNI_EXEC_DENY prefix are refused, even behind sudo.",
+		Examples: []string{"/exec git status"}},
+	{Name: "mcpconfig", Args: "[raw]", Section: "files", Description: "Show MCP servers from .mcp.json"},
+	{Name: "mcptest", Args: "<server>", Section: "files", Description: "Check that an MCP server responds"},
+
+	{Name: "sessions", Args: "[recent|created|name|size] [#tag]", Section: "sessions", Description: "List all sessions",
+		Examples: []string{"/sessions size", "/sessions #work"}},
+	{Name: "newsession", Args: "<name> [description]", Section: "sessions", Description: "Create new session",
+		Details:  "Each session gets its own directory under /workspace.",
+		Examples: []string{"/newsession api Backend refactor"}},
+	{Name: "switch", Args: "<name>", Section: "sessions", Description: "Switch to session"},
+	{Name: "fork", Args: "<newname>", Section: "sessions", Description: "Branch the current conversation into a new session"},
+	{Name: "delsession", Args: "<name>", Section: "sessions", Description: "Delete session"},
+	{Name: "delsessions", Args: "<pattern> [--include-current]", Section: "sessions", Description: "Delete matching sessions",
+		Details:  "The pattern is a glob or a name prefix. Transcripts are archived first.",
+		Examples: []string{"/delsessions test-*"}},
+	{Name: "exportsessions", Section: "sessions", Description: "Download the session index as JSON"},
+	{Name: "importsessions", Args: "[merge|replace]", Section: "sessions", Description: "Restore sessions from an exported file",
+		Details: "Send the exported .json file with this command as its caption."},
+	{Name: "tag", Args: "<tag>", Section: "sessions", Description: "Tag the current session"},
+	{Name: "untag", Args: "<tag>", Section: "sessions", Description: "Remove a tag from the current session"},
+	{Name: "pin", Args: "[name]", Section: "sessions", Description: "Keep a session at the top of /sessions"},
+	{Name: "unpin", Args: "[name]", Section: "sessions", Description: "Unpin a session"},
+	{Name: "system", Args: "[text]", Section: "sessions", Description: "Set (or clear) the session's system prompt",
+		Examples: []string{"/system Always answer in French"}},
+	{Name: "tools", Args: "[list|default]", Section: "sessions", Description: "Show or limit the tools Claude may use in this session",
+		Details:  "Separate tools with spaces or commas. The list applies on top of any /profile, and default restores the standard tools.",
+		Examples: []string{"/tools Read Glob Grep", "/tools Read, Bash(git log:*)", "/tools default"}},
+	{Name: "clear", Section: "sessions", Description: "Start a fresh conversation in the current session"},
+	{Name: "cost", Section: "sessions", Description: "Show spend for this and all sessions"},
+	{Name: "usage", Section: "sessions", Description: "Show token usage and cost for this session"},
+	{Name: "history", Args: "[n]", Section: "sessions", Description: "Show the last n messages of this session's conversation",
+		Details: "Defaults to 10 messages, at most 50. Tool calls and results are left out, and long messages are shortened."},
+	{Name: "sessionid", Section: "sessions", Description: "Show the Claude session ID and resume command"},
+	{Name: "status", Section: "sessions", Description: "Show current session status"},
+
+	{Name: "schedule", Args: "<interval> <prompt>", Section: "automation", Description: "Run a prompt periodically",
+		Details:  "The interval is @hourly, @daily, @weekly or a duration such as 30m.",
+		Examples: []string{"/schedule @daily Summarize new GitHub issues"}},
+	{Name: "schedules", Section: "automation", Description: "List scheduled prompts"},
+	{Name: "unschedule", Args: "<id>", Section: "automation", Description: "Remove a scheduled prompt"},
+
+	{Name: "abortall", Section: "admin", Description: "Stop every running query"},
+	{Name: "setdefaultmodel", Args: "<model>", Section: "admin", Description: "Change and save the default model"},
+	{Name: "ctx", Section: "admin", Description: "Show this chat's resolved state"},
+	{Name: "log", Args: "[n]", Section: "admin", Description: "Show the last n lines of the bot log"},
+
+	{Name: "start", Section: "help", Description: "Show this command summary"},
+	{Name: "help", Args: "[command]", Section: "help", Description: "Show detailed help for a command",
+		Examples: []string{"/help cat"}},
+	{Name: "version", Section: "help", Description: "Show bot and Claude versions"},
+}
+
+// findCommand returns the table entry for name
+func findCommand(name string) (commandInfo, bool) {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd, true
+		}
+	}
+	return commandInfo{}, false
+}
+
+// lookup returns the catalog message for key, or fallback if the catalog
+// doesn't define it
+func (b *Bot) lookup(key, fallback string) string {
+	if text, ok := b.messages[key]; ok {
+		return text
+	}
+	return fallback
+}
+
+// commandUsage renders "/name args"
+func commandUsage(cmd commandInfo) string {
+	if cmd.Args == "" {
+		return "/" + cmd.Name
+	}
+	return "/" + cmd.Name + " " + cmd.Args
+}
+
+// commandSummary renders the /start help from the command table
+func (b *Bot) commandSummary() string {
+	var text strings.Builder
+	text.WriteString(b.t("welcome"))
+
+	for _, section := range commandSections {
+		text.WriteString("\n\n" + b.lookup("section."+section.key, section.title) + ":")
+		for _, cmd := range commands {
+			if cmd.Section == section.key {
+				text.WriteString(fmt.Sprintf("\n%s - %s", commandUsage(cmd), b.lookup("cmd."+cmd.Name, cmd.Description)))
+			}
+		}
+	}
+	return text.String()
+}
+
+// commandHelp renders /help for a single command
+func (b *Bot) commandHelp(cmd commandInfo) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("%s\n\n%s", commandUsage(cmd), b.lookup("cmd."+cmd.Name, cmd.Description)))
+	if cmd.Details != "" {
+		text.WriteString("\n\n" + b.lookup("details."+cmd.Name, cmd.Details))
+	}
+	if len(cmd.Examples) > 0 {
+		text.WriteString("\n\n" + b.t("examples") + "\n" + strings.Join(cmd.Examples, "\n"))
+	}
+	return text.String()
+}
+
+// suggestCommands returns commands whose names are close to name
+func suggestCommands(name string) []string {
+	var matches []string
+	for _, cmd := range commands {
+		if strings.HasPrefix(cmd.Name, name) || strings.HasPrefix(name, cmd.Name) || editDistance(name, cmd.Name) <= 2 {
+			matches = append(matches, "/"+cmd.Name)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// registerCommands publishes the command table as Telegram's command menu
+func (b *Bot) registerCommands() {
+	menu := make([]tgbotapi.BotCommand, 0, len(commands))
+	for _, cmd := range commands {
+		menu = append(menu, tgbotapi.BotCommand{
+			Command:     cmd.Name,
+			Description: truncateRunes(b.lookup("cmd."+cmd.Name, cmd.Description), 256),
+		})
+	}
+	if _, err := b.api.Request(tgbotapi.NewSetMyCommands(menu...)); err != nil {
+		log.Printf("Failed to register bot commands: %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/drew/omnik-bot/internal/fsutil"
+)
+
+// configKeys lists every setting LoadConfigFromEnv understands. A config
+// file uses the same names as the environment variables.
+var configKeys = map[string]bool{
+	"TELEGRAM_BOT_TOKEN":            true,
+	"AUTHORIZED_USER_ID":            true,
+	"OMNI_CLIENT":                   true,
+	"USE_CLAUDE_SDK":                true,
+	"CLAUDE_MODEL":                  true,
+	"CLAUDE_BRIDGE_URL":             true,
+	"OMNI_AUDIT_LOG":                true,
+	"OMNI_MAX_CONCURRENT_QUERIES":   true,
+	"OMNI_RESPONSE_FILE_THRESHOLD":  true,
+	"OMNI_LONG_REPLY_AS_FILE_BYTES": true,
+	"OMNI_EXEC_ALLOWLIST":           true,
+	"OMNI_EXEC_ALLOW":               true,
+	"OMNI_EXEC_DENY":                true,
+	"OMNI_DEFAULT_SESSION_NAME":     true,
+	"OMNI_DEFAULT_SESSION_DIR":      true,
+	"OMNI_MAX_PROMPT_CHARS":         true,
+	"OMNI_COMMAND_ALIASES":          true,
+	"OMNI_SHOW_TIMINGS":             true,
+	"OMNI_SEND_IMAGES":              true,
+	"OMNI_PROFILES_FILE":            true,
+	"OMNI_LOG_FILE":                 true,
+	"OMNI_QUERY_RETRIES":            true,
+	"OMNI_LANG":                     true,
+	"OMNI_MAX_LINE_MB":              true,
+	"OMNI_CONFIRM_EXPENSIVE":        true,
+	"OMNI_CONFIRM_COST_USD":         true,
+	"OMNI_OBSERVER_CHAT_ID":         true,
+	"OMNI_QUEUE_DEPTH":              true,
+	"OMNI_WORKSPACE_ROOT":           true,
+	"OMNI_CLAUDE_TIMEOUT":           true,
+	"OMNI_EXEC_TIMEOUT":             true,
+	"OMNI_AUTO_RELOAD_MB":           true,
+	"OMNI_DOWNLOAD_MAX_MB":          true,
+	"OMNI_STT_URL":                  true,
+	"OMNI_STT_API_KEY":              true,
+	"OMNI_STT_MODEL":                true,
+	"OMNI_STT_COMMAND":              true,
+}
+
+// configSource resolves settings from the environment, falling back to
+// values read from a config file
+type configSource struct {
+	file map[string]string
+}
+
+// loadConfigSource reads the optional JSON config file named by
+// OMNI_CONFIG_FILE. Unknown keys are logged and ignored.
+func loadConfigSource() (*configSource, error) {
+	src := &configSource{file: make(map[string]string)}
+
+	path := os.Getenv("OMNI_CONFIG_FILE")
+	if path == "" {
+		return src, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OMNI_CONFIG_FILE: %w", err)
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid OMNI_CONFIG_FILE: %w", err)
+	}
+
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !configKeys[key] {
+			log.Printf("Warning: unknown key %q in %s", key, path)
+			continue
+		}
+
+		// Strings are used as-is and string lists are comma-joined; numbers,
+		// booleans and objects keep their JSON form, which is what the env
+		// parsers expect
+		var s string
+		var list []string
+		switch {
+		case json.Unmarshal(raw[key], &s) == nil:
+		case json.Unmarshal(raw[key], &list) == nil:
+			s = strings.Join(list, ",")
+		default:
+			s = string(raw[key])
+		}
+		src.file[key] = s
+	}
+
+	return src, nil
+}
+
+// setConfigValue sets key in the JSON config file at path, keeping the
+// file's other keys
+func setConfigValue(path, key, value string) error {
+	raw := make(map[string]json.RawMessage)
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return fmt.Errorf("invalid config file: %w", err)
+		}
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	raw[key] = encoded
+
+	data, err = json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(path, append(data, '\n'), 0600)
+}
+
+// get returns the environment value for key, or the config file value if
+// the variable is unset
+func (c *configSource) get(key string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return c.file[key]
+}
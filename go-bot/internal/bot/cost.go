@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// modelInputPrices is the approximate input price per million tokens, in
+// USD, by model family
+var modelInputPrices = map[string]float64{
+	"opus":   15,
+	"sonnet": 3,
+	"haiku":  0.8,
+}
+
+// expensiveModels are the model families that need a confirmation for
+// large prompts when OMNI_CONFIRM_EXPENSIVE is on
+var expensiveModels = map[string]bool{
+	"opus": true,
+}
+
+// modelFamily maps a model alias or full name (claude-opus-4-1, ...) to
+// its family
+func modelFamily(model string) string {
+	model = strings.ToLower(model)
+	for family := range modelInputPrices {
+		if strings.Contains(model, family) {
+			return family
+		}
+	}
+	return model
+}
+
+// estimateTokens roughly estimates the token count of text
+func estimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// estimatePromptCost estimates what sending prompt to model costs in input
+// tokens alone. Returns false if the model's price is unknown.
+func estimatePromptCost(model, prompt string) (float64, bool) {
+	price, ok := modelInputPrices[modelFamily(model)]
+	if !ok {
+		return 0, false
+	}
+	return float64(estimateTokens(prompt)) * price / 1e6, true
+}
+
+// queryModel returns the model a chat's queries run on: its /model choice,
+// then its profile's model, then the default
+func (b *Bot) queryModel(chatID int64) string {
+	if model := b.chatModel(chatID); model != "" {
+		return model
+	}
+	if _, profile, ok := b.chatProfile(chatID); ok && profile.Model != "" {
+		return profile.Model
+	}
+	return b.getDefaultModel()
+}
+
+// submitPrompt forwards prompt to Claude, first asking for confirmation
+// when it would be expensive
+func (b *Bot) submitPrompt(ctx context.Context, msg *tgbotapi.Message, prompt string) {
+	if b.confirmExpensive {
+		model := b.queryModel(msg.Chat.ID)
+		if expensiveModels[modelFamily(model)] {
+			if cost, ok := estimatePromptCost(model, prompt); ok && cost >= b.confirmCostUSD {
+				b.askConfirm(msg.Chat.ID, b.t("expensive_prompt",
+					formatTokens(estimateTokens(prompt)), model, cost,
+				), b.t("button_run"), func() {
+					go b.forwardToClaude(ctx, msg, prompt)
+				})
+				return
+			}
+		}
+	}
+
+	go b.forwardToClaude(ctx, msg, prompt)
+}
@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// downloadTimeout bounds a whole /download, including the body
+const downloadTimeout = 10 * time.Minute
+
+// downloadProgressInterval is how often the progress message is edited
+const downloadProgressInterval = 3 * time.Second
+
+// downloadFilename picks the file name for a /download: the given name, or
+// the last segment of the URL path
+func downloadFilename(u *url.URL, name string) (string, error) {
+	if name == "" {
+		name = path.Base(u.Path)
+	}
+	if name == "" || name == "." || name == ".." || name == "/" || strings.ContainsAny(name, "/\\") {
+		return "", fmt.Errorf("can't derive a file name from the URL, pass one: /download <url> <filename>")
+	}
+	return name, nil
+}
+
+// progressWriter counts bytes written and periodically reports them
+type progressWriter struct {
+	written  int64
+	last     time.Time
+	onUpdate func(written int64)
+}
+
+func (p *progressWriter) Write(data []byte) (int, error) {
+	p.written += int64(len(data))
+	if time.Since(p.last) >= downloadProgressInterval {
+		p.last = time.Now()
+		p.onUpdate(p.written)
+	}
+	return len(data), nil
+}
+
+// downloadURL fetches rawURL into the working directory for /download
+func (b *Bot) downloadURL(ctx context.Context, msg *tgbotapi.Message, rawURL, name string) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("download_bad_url")))
+		return
+	}
+	name, err = downloadFilename(u, name)
+	if err != nil {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+		return
+	}
+
+	dest := filepath.Join(b.getWorkingDir(msg.Chat.ID), name)
+	if !b.checkSandbox(msg.Chat.ID, dest) {
+		return
+	}
+	if _, err := os.Stat(dest); err == nil {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("already_exists", dest)))
+		return
+	}
+
+	sent, err := b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("downloading", name)))
+	if err != nil {
+		log.Printf("Failed to send download message: %v", err)
+		return
+	}
+	report := func(text string) {
+		b.editText(msg.Chat.ID, sent.MessageID, text)
+	}
+
+	size, err := b.fetchToFile(ctx, u.String(), dest, func(written int64) {
+		report(b.t("downloading_progress", name, formatSize(written)))
+	})
+	if err != nil {
+		log.Printf("Download of %s failed: %v", u.Redacted(), err)
+		report(b.t("error", err))
+		return
+	}
+
+	log.Printf("Downloaded %s to %s (%d bytes)", u.Redacted(), dest, size)
+	report(b.t("downloaded", dest, formatSize(size)))
+}
+
+// fetchToFile streams rawURL into dest, refusing bodies over the download
+// limit. dest only appears once the download has completed.
+func (b *Bot) fetchToFile(ctx context.Context, rawURL, dest string, onProgress func(int64)) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("download failed: status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > b.downloadMaxBytes {
+		return 0, fmt.Errorf("file too large (%s, max %s)", formatSize(resp.ContentLength), formatSize(b.downloadMaxBytes))
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".download-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	progress := &progressWriter{last: time.Now(), onUpdate: onProgress}
+	body := io.TeeReader(io.LimitReader(resp.Body, b.downloadMaxBytes+1), progress)
+	size, err := io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("download failed: %w", err)
+	}
+	if size > b.downloadMaxBytes {
+		return 0, fmt.Errorf("file too large (over %s)", formatSize(b.downloadMaxBytes))
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return 0, fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return 0, fmt.Errorf("failed to save file: %w", err)
+	}
+	return size, nil
+}
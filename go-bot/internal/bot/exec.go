@@ -0,0 +1,317 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// shellMetacharacters could chain or redirect commands past the allowlist
+const shellMetacharacters = ";&|`$<>(){}\n\\"
+
+// execRejectedError explains why /exec refused a command. Key names the
+// catalog message shown to the user, with Args filling it in.
+type execRejectedError struct {
+	Key  string
+	Args []interface{}
+	text string
+}
+
+func (e *execRejectedError) Error() string {
+	return "command not allowed: " + e.text
+}
+
+// checkExecAllowed verifies that command's leading binary is on the
+// allowlist. An empty allowlist allows everything.
+func checkExecAllowed(command string, allowlist []string) error {
+	if len(allowlist) == 0 {
+		return nil
+	}
+
+	if strings.ContainsAny(command, shellMetacharacters) {
+		return &execRejectedError{Key: "exec_shell_operators", text: "shell operators are disabled"}
+	}
+
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return &execRejectedError{Key: "exec_empty", text: "empty command"}
+	}
+
+	// Match on the binary name so /usr/bin/git and git are treated alike
+	binary := filepath.Base(fields[0])
+	for _, allowed := range allowlist {
+		if binary == allowed {
+			return nil
+		}
+	}
+
+	return &execRejectedError{Key: "exec_not_allowed", Args: []interface{}{binary}, text: binary}
+}
+
+// execSeparators split a command line into the commands it chains or nests
+const execSeparators = ";&|`(){}\n"
+
+// execWrappers run the command that follows them, so they are skipped
+// when matching against the denylist
+var execWrappers = map[string]bool{
+	"sudo": true, "doas": true, "env": true, "command": true, "builtin": true,
+	"exec": true, "nohup": true, "time": true, "nice": true, "ionice": true,
+	"timeout": true, "xargs": true,
+}
+
+// execWrapperValueFlags are wrapper flags that take a value, such as
+// sudo -u root or timeout -s KILL
+var execWrapperValueFlags = map[string]bool{
+	"-u": true, "-g": true, "-C": true, "-D": true, "-U": true, "-r": true,
+	"-t": true, "-n": true, "-c": true, "-s": true, "-k": true, "-p": true,
+}
+
+// execShells are skipped along with their -c flag, so bash -c "reboot"
+// is matched as reboot
+var execShells = map[string]bool{"sh": true, "bash": true, "zsh": true, "dash": true}
+
+// normalizeExecCommand reduces one command to the words that matter for
+// matching: quotes and escapes removed, environment assignments and
+// wrappers such as sudo stripped, and the binary reduced to its base name
+func normalizeExecCommand(command string) []string {
+	words := strings.Fields(strings.NewReplacer(`"`, "", "'", "", `\`, "").Replace(command))
+
+	for len(words) > 0 {
+		word := words[0]
+		switch {
+		case strings.Contains(word, "=") && !strings.HasPrefix(word, "-"):
+			words = words[1:]
+		case execWrappers[filepath.Base(word)]:
+			// Drop the wrapper's own flags and arguments (sudo -u root,
+			// timeout 10, nice -n 5) up to the wrapped command
+			words = words[1:]
+			for len(words) > 0 && (strings.HasPrefix(words[0], "-") || isNumeric(words[0])) {
+				if execWrapperValueFlags[words[0]] && len(words) > 1 {
+					words = words[1:]
+				}
+				words = words[1:]
+			}
+		case execShells[filepath.Base(word)] && len(words) > 1 && words[1] == "-c":
+			words = words[2:]
+		default:
+			words[0] = filepath.Base(word)
+			return words
+		}
+	}
+	return nil
+}
+
+// isNumeric reports whether s is a plain number such as a timeout
+func isNumeric(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789.") == ""
+}
+
+// checkExecDenied rejects command if any command it chains starts with a
+// denylist entry. Entries are matched word by word, so "rm -rf /" blocks
+// "sudo rm -rf /" but not "rm -rf /tmp/x".
+func checkExecDenied(command string, denylist []string) error {
+	if len(denylist) == 0 {
+		return nil
+	}
+
+	for _, part := range strings.FieldsFunc(command, func(r rune) bool {
+		return strings.ContainsRune(execSeparators, r)
+	}) {
+		words := normalizeExecCommand(part)
+		if len(words) == 0 {
+			continue
+		}
+		for _, denied := range denylist {
+			if hasWordPrefix(words, normalizeExecCommand(denied)) {
+				return &execRejectedError{Key: "exec_denied", Args: []interface{}{denied}, text: denied + " is denied"}
+			}
+		}
+	}
+	return nil
+}
+
+// hasWordPrefix reports whether words starts with every word of prefix
+func hasWordPrefix(words, prefix []string) bool {
+	if len(prefix) == 0 || len(prefix) > len(words) {
+		return false
+	}
+	for i, word := range prefix {
+		if words[i] != word {
+			return false
+		}
+	}
+	return true
+}
+
+// execUpdateInterval is how often a running command's message is edited
+// with its latest output
+const execUpdateInterval = 2 * time.Second
+
+// execMaxMessages caps how many messages a command's final output is
+// split across
+const execMaxMessages = 5
+
+// execOutput collects a command's combined stdout and stderr while it runs
+type execOutput struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *execOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+// String returns everything written so far
+func (o *execOutput) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+// completeLines returns the output up to its last newline, so partial
+// lines aren't shown while the command runs
+func (o *execOutput) completeLines() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	out := o.buf.Bytes()
+	return string(out[:bytes.LastIndexByte(out, '\n')+1])
+}
+
+// execDirectCommand executes a command directly using os/exec, editing the
+// reply with its output as it runs. /stop kills it.
+func (b *Bot) execDirectCommand(msg *tgbotapi.Message, command string, args ...string) {
+	log.Printf("Executing command directly: %s %v", command, args)
+
+	// One command per chat, registered so /stop and shutdown can kill it
+	run := b.registerExec(msg.Chat.ID)
+	if run == nil {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("exec_running")))
+		return
+	}
+	defer b.queryWG.Done()
+	defer b.unregisterExec(msg.Chat.ID, run)
+
+	// Send thinking message
+	thinkingMsg := tgbotapi.NewMessage(msg.Chat.ID, b.t("executing"))
+	sentMsg, err := b.api.Send(thinkingMsg)
+	if err != nil {
+		log.Printf("Failed to send thinking message: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if b.execTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, b.execTimeout)
+		defer cancel()
+	}
+	go func() {
+		select {
+		case <-run.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var output execOutput
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Dir = b.getWorkingDir(msg.Chat.ID)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Run in its own process group and kill the whole group, so children
+	// the shell started (builds, servers, sleeps) don't outlive it
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// Background children may hold the output pipe open after a kill
+	cmd.WaitDelay = 5 * time.Second
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		b.api.Send(tgbotapi.NewEditMessageText(msg.Chat.ID, sentMsg.MessageID, b.t("error", err)))
+		return
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	// Show the latest complete lines until the command exits
+	ticker := time.NewTicker(execUpdateInterval)
+	defer ticker.Stop()
+	lastSent := thinkingMsg.Text
+	for running := true; running; {
+		select {
+		case err = <-done:
+			running = false
+		case <-ticker.C:
+			text := output.completeLines()
+			if text == "" {
+				continue
+			}
+			if telegramLen(text) > telegramLimit-100 {
+				text = b.t("truncated") + "\n\n" + tailTelegram(text, telegramLimit-100)
+			}
+			text = b.t("still_working", strings.TrimRight(text, "\n"), time.Since(start).Round(time.Second))
+			if text != lastSent {
+				if _, editErr := b.api.Send(tgbotapi.NewEditMessageText(msg.Chat.ID, sentMsg.MessageID, text)); editErr == nil {
+					lastSent = text
+				}
+			}
+		}
+	}
+
+	// Prepare response text
+	var text string
+	reason, stopped := run.stopReason()
+	switch {
+	case stopped:
+		text = b.t("exec_output", reason, output.String())
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		text = b.t("exec_output", b.t("exec_timed_out", b.execTimeout), output.String())
+	case err != nil:
+		text = b.t("exec_output", b.t("error", err), output.String())
+	default:
+		text = output.String()
+		if text == "" {
+			text = b.t("exec_no_output")
+		}
+	}
+
+	// Long output goes out over several messages, then is truncated
+	chunks := splitTelegram(text, telegramLimit)
+	if len(chunks) > execMaxMessages {
+		chunks = chunks[:execMaxMessages]
+		last := len(chunks) - 1
+		chunks[last] = truncateTelegram(chunks[last], telegramLimit-100) + "\n\n" + b.t("truncated")
+	}
+	b.api.Send(tgbotapi.NewEditMessageText(msg.Chat.ID, sentMsg.MessageID, chunks[0]))
+	for _, chunk := range chunks[1:] {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, chunk))
+	}
+}
+
+// splitTelegram splits s into pieces of at most n UTF-16 code units,
+// breaking after a newline where possible
+func splitTelegram(s string, n int) []string {
+	var chunks []string
+	for telegramLen(s) > n {
+		chunk := truncateTelegram(s, n)
+		if i := strings.LastIndexByte(chunk, '\n'); i > 0 {
+			chunk = chunk[:i+1]
+		}
+		chunks = append(chunks, chunk)
+		s = s[len(chunk):]
+	}
+	return append(chunks, s)
+}
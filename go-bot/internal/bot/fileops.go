@@ -0,0 +1,188 @@
+package bot
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// parseFileOpArgs splits /rm, /mv and /cp arguments into paths and the -r flag
+func parseFileOpArgs(args string) (paths []string, recursive bool) {
+	for _, field := range strings.Fields(args) {
+		if field == "-r" || field == "-R" {
+			recursive = true
+			continue
+		}
+		paths = append(paths, field)
+	}
+	return paths, recursive
+}
+
+// resolveFileOpPaths resolves paths against the working directory, telling
+// the chat and returning false if any is outside the sandbox
+func (b *Bot) resolveFileOpPaths(chatID int64, paths []string) ([]string, bool) {
+	resolved := make([]string, len(paths))
+	for i, p := range paths {
+		resolved[i] = b.resolvePath(chatID, p)
+		if !b.checkSandbox(chatID, resolved[i]) {
+			return nil, false
+		}
+	}
+	return resolved, true
+}
+
+// statFileOpSource stats the source of a file operation, refusing
+// directories without -r and the workspace root itself
+func (b *Bot) statFileOpSource(path string, recursive bool) (fs.FileInfo, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Clean(path) == filepath.Clean(b.workspaceRoot) {
+		return nil, fmt.Errorf("refusing to operate on the workspace root")
+	}
+	if info.IsDir() && !recursive {
+		return nil, fmt.Errorf("%s is a directory (use -r)", path)
+	}
+	return info, nil
+}
+
+// fileOpTarget returns where src ends up when moved or copied to dst: into
+// dst if it is an existing directory, otherwise dst itself
+func fileOpTarget(src, dst string) string {
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		return filepath.Join(dst, filepath.Base(src))
+	}
+	return dst
+}
+
+// handleRemove asks for confirmation, then deletes the path for /rm
+func (b *Bot) handleRemove(msg *tgbotapi.Message) {
+	paths, recursive := parseFileOpArgs(msg.CommandArguments())
+	if len(paths) != 1 {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", "/rm [-r] <path>")))
+		return
+	}
+	resolved, ok := b.resolveFileOpPaths(msg.Chat.ID, paths)
+	if !ok {
+		return
+	}
+	path := resolved[0]
+
+	info, err := b.statFileOpSource(path, recursive)
+	if err != nil {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+		return
+	}
+
+	prompt := b.t("rm_file_prompt", path, formatSize(info.Size()))
+	if info.IsDir() {
+		prompt = b.t("rm_dir_prompt", path)
+	}
+	b.askConfirm(msg.Chat.ID, prompt, b.t("button_delete"), func() {
+		if err := os.RemoveAll(path); err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return
+		}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("deleted_path", path)))
+	})
+}
+
+// handleMoveOrCopy runs /mv and /cp
+func (b *Bot) handleMoveOrCopy(msg *tgbotapi.Message, move bool) {
+	command := "/cp"
+	if move {
+		command = "/mv"
+	}
+
+	paths, recursive := parseFileOpArgs(msg.CommandArguments())
+	if len(paths) != 2 {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("usage", command+" [-r] <src> <dst>")))
+		return
+	}
+	resolved, ok := b.resolveFileOpPaths(msg.Chat.ID, paths)
+	if !ok {
+		return
+	}
+	src, dst := resolved[0], fileOpTarget(resolved[0], resolved[1])
+
+	info, err := b.statFileOpSource(src, recursive)
+	if err == nil && info.IsDir() && strings.HasPrefix(dst+"/", src+"/") {
+		err = fmt.Errorf("can't %s a directory into itself", strings.TrimPrefix(command, "/"))
+	}
+	if err == nil {
+		if move {
+			err = os.Rename(src, dst)
+		} else {
+			err = copyPath(src, dst)
+		}
+	}
+	if err != nil {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+		return
+	}
+
+	done := b.t("copied", src, dst)
+	if move {
+		done = b.t("moved", src, dst)
+	}
+	b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, done))
+}
+
+// copyPath copies a file, symlink or directory tree from src to dst,
+// keeping permissions
+func copyPath(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyRegularFile(path, target, info.Mode().Perm())
+		default:
+			return fmt.Errorf("can't copy special file %s", path)
+		}
+	})
+}
+
+// copyRegularFile copies one file's contents to dst with mode perm
+func copyRegularFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
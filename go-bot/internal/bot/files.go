@@ -0,0 +1,379 @@
+package bot
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// codeBlockLimit keeps a fenced block (plus escaping) under Telegram's limit
+const codeBlockLimit = 3800
+
+// languageByExt maps file extensions to code block language tags
+var languageByExt = map[string]string{
+	".go":   "go",
+	".py":   "python",
+	".js":   "javascript",
+	".ts":   "typescript",
+	".tsx":  "tsx",
+	".jsx":  "jsx",
+	".rs":   "rust",
+	".java": "java",
+	".c":    "c",
+	".h":    "c",
+	".cpp":  "cpp",
+	".rb":   "ruby",
+	".php":  "php",
+	".sh":   "bash",
+	".json": "json",
+	".yaml": "yaml",
+	".yml":  "yaml",
+	".toml": "toml",
+	".md":   "markdown",
+	".html": "html",
+	".css":  "css",
+	".sql":  "sql",
+	".xml":  "xml",
+}
+
+// resolvePath resolves a user-supplied path against the chat's working directory
+func (b *Bot) resolvePath(chatID int64, path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = b.getWorkingDir(chatID) + "/" + path
+	}
+	return cleanPath(path)
+}
+
+// describeFile builds the /info report for a file or directory
+func (b *Bot) describeFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("📄 %s\n\n", path))
+	text.WriteString(b.t("info_mode", info.Mode()) + "\n")
+	text.WriteString(b.t("info_modified", info.ModTime().Format("2006-01-02 15:04:05")) + "\n")
+
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return "", err
+		}
+		text.WriteString(b.t("info_type", b.t("info_directory")) + "\n")
+		text.WriteString(b.t("info_entries", len(entries)) + "\n")
+		text.WriteString(b.t("info_total_size", formatSize(dirSize(path))) + "\n")
+		return text.String(), nil
+	}
+
+	text.WriteString(b.t("info_size", formatSize(info.Size())) + "\n")
+	text.WriteString(b.t("info_type", b.detectFileType(path)) + "\n")
+	return text.String(), nil
+}
+
+// detectFileType combines the extension's MIME type with a sniff of the
+// file's first 512 bytes
+func (b *Bot) detectFileType(path string) string {
+	byExt := mime.TypeByExtension(filepath.Ext(path))
+
+	head, err := sniffFile(path)
+	if err != nil {
+		return byExt
+	}
+	sniffed := http.DetectContentType(head)
+
+	switch {
+	case byExt == "":
+		return sniffed
+	case strings.SplitN(byExt, ";", 2)[0] == strings.SplitN(sniffed, ";", 2)[0]:
+		return byExt
+	default:
+		return b.t("info_type_mismatch", byExt, sniffed)
+	}
+}
+
+// sniffFile returns up to the first 512 bytes of a file
+func sniffFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// checkTextFile returns an error if path looks like a binary file that
+// can't be displayed as text
+func checkTextFile(path string) error {
+	head, err := sniffFile(path)
+	if err != nil {
+		return err
+	}
+
+	contentType := http.DetectContentType(head)
+	isText := strings.HasPrefix(contentType, "text/") ||
+		strings.Contains(contentType, "json") ||
+		strings.Contains(contentType, "xml") ||
+		strings.Contains(contentType, "javascript")
+	if isText && !bytes.ContainsRune(head, 0) {
+		return nil
+	}
+
+	return fmt.Errorf("binary file (%s) — it can't be shown as text", strings.SplitN(contentType, ";", 2)[0])
+}
+
+// dirSize sums the sizes of all regular files under dir, skipping
+// entries that can't be read
+func dirSize(dir string) int64 {
+	var total int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
+
+// duEntry is one direct child of a directory and its total size
+type duEntry struct {
+	name  string
+	isDir bool
+	size  int64
+}
+
+// describeDiskUsage builds the /du report: the total size of path and,
+// for a directory, its largest direct children
+func (b *Bot) describeDiskUsage(path string, top int) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return b.t("du_file", path, formatSize(info.Size())), nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return "", err
+	}
+
+	var total int64
+	usage := make([]duEntry, 0, len(entries))
+	for _, entry := range entries {
+		e := duEntry{name: entry.Name(), isDir: entry.IsDir()}
+		if e.isDir {
+			e.size = dirSize(filepath.Join(path, entry.Name()))
+		} else if entry.Type().IsRegular() {
+			if fi, err := entry.Info(); err == nil {
+				e.size = fi.Size()
+			}
+		}
+		total += e.size
+		usage = append(usage, e)
+	}
+
+	sort.Slice(usage, func(i, j int) bool { return usage[i].size > usage[j].size })
+	if len(usage) > top {
+		usage = usage[:top]
+	}
+
+	var text strings.Builder
+	text.WriteString(b.tn("du_dir", len(entries), path, formatSize(total)) + "\n")
+	if len(usage) > 0 {
+		text.WriteString("\n" + b.t("du_largest") + "\n")
+		for _, e := range usage {
+			name := e.name
+			if e.isDir {
+				name += "/"
+			}
+			text.WriteString(fmt.Sprintf("• %s - %s\n", name, formatSize(e.size)))
+		}
+	}
+	return text.String(), nil
+}
+
+// Limits for /recent so large trees stay responsive
+const (
+	recentMaxDepth = 8
+	recentMaxFiles = 20000
+)
+
+// recentSkipDirs are directories /recent doesn't descend into
+var recentSkipDirs = map[string]bool{
+	".git":         true,
+	"node_modules": true,
+}
+
+// recentFile is a file found by /recent
+type recentFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// recentFiles returns the n most recently modified files under root. The
+// walk stops descending past recentMaxDepth and after recentMaxFiles files;
+// the second result reports whether it was cut short.
+func recentFiles(root string, n int) ([]recentFile, bool, error) {
+	if _, err := os.Stat(root); err != nil {
+		return nil, false, err
+	}
+
+	var files []recentFile
+	scanned := 0
+	truncated := false
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		if d.IsDir() {
+			if path != root && (recentSkipDirs[d.Name()] || strings.Count(rel, string(filepath.Separator)) >= recentMaxDepth) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		scanned++
+		if scanned > recentMaxFiles {
+			truncated = true
+			return filepath.SkipAll
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files = append(files, recentFile{path: rel, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+	if len(files) > n {
+		files = files[:n]
+	}
+	return files, truncated, nil
+}
+
+// languageForFile infers a code block language tag from the file name
+func languageForFile(path string) string {
+	if filepath.Base(path) == "Dockerfile" {
+		return "dockerfile"
+	}
+	return languageByExt[strings.ToLower(filepath.Ext(path))]
+}
+
+// parseLineRange parses "start:end" (1-based, inclusive). Either side may be
+// omitted, e.g. "10:" or ":40".
+func parseLineRange(arg string) (int, int, bool) {
+	startStr, endStr, found := strings.Cut(arg, ":")
+	if !found || (startStr == "" && endStr == "") {
+		return 0, 0, false
+	}
+
+	start, end := 1, 0
+	var err error
+	if startStr != "" {
+		if start, err = strconv.Atoi(startStr); err != nil || start < 1 {
+			return 0, 0, false
+		}
+	}
+	if endStr != "" {
+		if end, err = strconv.Atoi(endStr); err != nil || end < start {
+			return 0, 0, false
+		}
+	}
+	return start, end, true
+}
+
+// readLines reads lines start..end (1-based, inclusive) of a file. Zero
+// start reads from the beginning and zero end reads to the end.
+func readLines(path string, start, end int) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var out strings.Builder
+	reader := bufio.NewReader(file)
+	for lineNo := 1; end == 0 || lineNo <= end; lineNo++ {
+		line, err := reader.ReadString('\n')
+		if lineNo >= start {
+			out.WriteString(line)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		// Stop early once there is more than can be shown
+		if out.Len() > codeBlockLimit {
+			break
+		}
+	}
+
+	return out.String(), nil
+}
+
+// sendCodeBlock sends content as a fenced MarkdownV2 code block, falling
+// back to plain text if Telegram rejects the formatting
+func (b *Bot) sendCodeBlock(chatID int64, content, language string) {
+	truncated := false
+	if telegramLen(content) > codeBlockLimit {
+		content = truncateTelegram(content, codeBlockLimit)
+		truncated = true
+	}
+	if content == "" {
+		content = b.t("empty")
+	}
+
+	// Inside pre blocks only backslash and backtick need escaping
+	escaped := codeBlockEscaper.Replace(content)
+	text := "```" + language + "\n" + escaped + "\n```"
+	if truncated {
+		text += "\n" + escapeMarkdownV2(b.t("truncated"))
+	}
+
+	reply := tgbotapi.NewMessage(chatID, text)
+	reply.ParseMode = tgbotapi.ModeMarkdownV2
+	if _, err := b.api.Send(reply); err != nil {
+		log.Printf("Failed to send code block, falling back to plain text: %v", err)
+		if truncated {
+			content += "\n\n" + b.t("truncated")
+		}
+		b.api.Send(tgbotapi.NewMessage(chatID, content))
+	}
+}
@@ -0,0 +1,68 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// healthCheckInterval is how often the background loop re-pings Claude
+const healthCheckInterval = 5 * time.Minute
+
+// healthStatus is the last known result of a Claude health check
+type healthStatus struct {
+	Healthy   bool
+	Err       error
+	CheckedAt time.Time
+}
+
+// checkHealth pings Claude, records the result and returns it
+func (b *Bot) checkHealth(ctx context.Context) healthStatus {
+	checkCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	err := b.claudeClient.Health(checkCtx)
+	status := healthStatus{
+		Healthy:   err == nil,
+		Err:       err,
+		CheckedAt: time.Now(),
+	}
+
+	b.healthMu.Lock()
+	previous := b.health
+	b.health = status
+	b.healthMu.Unlock()
+
+	// Only log on first check and on transitions to keep the log quiet
+	if previous.CheckedAt.IsZero() || previous.Healthy != status.Healthy {
+		if err != nil {
+			log.Printf("WARNING: Claude health check failed: %v", err)
+		} else {
+			log.Printf("✓ Claude is healthy")
+		}
+	}
+
+	return status
+}
+
+// getHealth returns the last known Claude health status
+func (b *Bot) getHealth() healthStatus {
+	b.healthMu.RLock()
+	defer b.healthMu.RUnlock()
+	return b.health
+}
+
+// healthLoop re-checks Claude health periodically until ctx is cancelled
+func (b *Bot) healthLoop(ctx context.Context) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.checkHealth(ctx)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package bot
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+)
+
+// locales holds the message catalogs, one JSON file per language
+//
+//go:embed locales/*.json
+var locales embed.FS
+
+// defaultLang is used for any key missing from the selected catalog
+const defaultLang = "en"
+
+// catalog maps message keys to format strings
+type catalog map[string]string
+
+// loadCatalog returns the catalog for lang, with English filling in any
+// keys the language doesn't define
+func loadCatalog(lang string) (catalog, error) {
+	base, err := readCatalog(defaultLang)
+	if err != nil {
+		return nil, err
+	}
+	if lang == "" || lang == defaultLang {
+		return base, nil
+	}
+
+	translated, err := readCatalog(lang)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported language %q: %w", lang, err)
+	}
+	for key, text := range translated {
+		base[key] = text
+	}
+	return base, nil
+}
+
+// readCatalog parses the embedded catalog for lang
+func readCatalog(lang string) (catalog, error) {
+	data, err := locales.ReadFile("locales/" + lang + ".json")
+	if err != nil {
+		return nil, err
+	}
+
+	var c catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid catalog for %s: %w", lang, err)
+	}
+	return c, nil
+}
+
+// t returns the message for key in the configured language, formatted with
+// args. Unknown keys are returned as-is so a missing entry is visible.
+func (b *Bot) t(key string, args ...interface{}) string {
+	text, ok := b.messages[key]
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// tn returns the message for count using key+".one" when count is 1 and
+// key+".other" otherwise, formatted with count followed by args
+func (b *Bot) tn(key string, count int, args ...interface{}) string {
+	if count == 1 {
+		key += ".one"
+	} else {
+		key += ".other"
+	}
+	return b.t(key, append([]interface{}{count}, args...)...)
+}
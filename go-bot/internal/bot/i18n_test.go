@@ -0,0 +1,88 @@
+package bot
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// formatVerb matches a fmt verb, including flags, argument indexes, width
+// and precision
+var formatVerb = regexp.MustCompile(`%[-+# 0]*(\[\d+\])?[\d.]*(\[\d+\])?[a-zA-Z%]`)
+
+// argIndex matches an explicit argument index such as [2]
+var argIndex = regexp.MustCompile(`\[\d+\]`)
+
+// verbs returns the sorted fmt verbs in text, ignoring flags and width
+func verbs(text string) string {
+	var found []string
+	for _, v := range formatVerb.FindAllString(text, -1) {
+		if v == "%%" {
+			continue
+		}
+		index := argIndex.FindString(v)
+		found = append(found, index+v[len(v)-1:])
+	}
+	sort.Strings(found)
+	return strings.Join(found, " ")
+}
+
+func TestCatalogsMatchEnglish(t *testing.T) {
+	en, err := readCatalog("en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	es, err := readCatalog("es")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, text := range es {
+		if strings.HasPrefix(key, "cmd.") || strings.HasPrefix(key, "section.") {
+			continue // English comes from the command table
+		}
+		english, ok := en[key]
+		if !ok {
+			t.Errorf("es key %q is missing from en", key)
+			continue
+		}
+		if verbs(text) != verbs(english) {
+			t.Errorf("%q: es verbs %q, en verbs %q", key, verbs(text), verbs(english))
+		}
+	}
+	for key := range en {
+		if _, ok := es[key]; !ok {
+			t.Errorf("en key %q is missing from es", key)
+		}
+	}
+}
+
+func TestCatalogFormatsCleanly(t *testing.T) {
+	b := &Bot{}
+	for _, lang := range []string{"en", "es"} {
+		messages, err := loadCatalog(lang)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.messages = messages
+		for key, text := range messages {
+			n := strings.Count(text, "%") - 2*strings.Count(text, "%%")
+			if n == 0 {
+				continue
+			}
+			args := make([]interface{}, n)
+			for i := range args {
+				args[i] = 1
+			}
+			// Argument types don't matter here, only indexes and counts
+			got := b.t(key, args...)
+			for _, problem := range []string{"BADINDEX", "BADPREC", "EXTRA", "MISSING", "NOVERB"} {
+				if strings.Contains(got, problem) {
+					t.Errorf("%s %q formats badly: %q", lang, key, got)
+					break
+				}
+			}
+		}
+	}
+}
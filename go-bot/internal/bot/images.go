@@ -0,0 +1,118 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxPhotoSize is the largest image Telegram accepts as a photo
+const maxPhotoSize = 10 << 20
+
+// maxSentImages caps how many images a single response sends
+const maxSentImages = 10
+
+// imageExtensions are the file types sent back as photos when Claude
+// writes them; .svg is rasterized first
+var imageExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".svg": true,
+}
+
+// writtenImagePath returns the absolute path of the image a Write tool_use
+// block creates, if it creates one. Relative paths resolve against workDir.
+func writtenImagePath(toolUse map[string]interface{}, workDir string) (string, bool) {
+	if name, _ := toolUse["name"].(string); name != "Write" {
+		return "", false
+	}
+	input, _ := toolUse["input"].(map[string]interface{})
+	path, _ := input["file_path"].(string)
+	if path == "" || !imageExtensions[strings.ToLower(filepath.Ext(path))] {
+		return "", false
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workDir, path)
+	}
+	return filepath.Clean(path), true
+}
+
+// sendWrittenImages sends the images Claude wrote during a query as
+// photos, skipping ones that are gone, outside the sandbox or too large
+func (b *Bot) sendWrittenImages(chatID int64, paths []string) {
+	if len(paths) > maxSentImages {
+		log.Printf("Sending only the first %d of %d written images", maxSentImages, len(paths))
+		paths = paths[:maxSentImages]
+	}
+
+	for _, path := range paths {
+		b.sendWrittenImage(chatID, path)
+	}
+}
+
+// sendWrittenImage sends one written image, removing any rasterized copy
+// once it's sent
+func (b *Bot) sendWrittenImage(chatID int64, path string) {
+	if !b.withinSandbox(path) {
+		log.Printf("Not sending image outside the workspace: %s", path)
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		log.Printf("Not sending written image %s: %v", path, err)
+		return
+	}
+
+	photoPath := path
+	if strings.EqualFold(filepath.Ext(path), ".svg") {
+		png, err := rasterizeSVG(path)
+		if err != nil {
+			// Telegram can't show SVG photos, but can still deliver the file
+			log.Printf("Failed to rasterize %s, sending as a document: %v", path, err)
+			doc := tgbotapi.NewDocument(chatID, tgbotapi.FilePath(path))
+			doc.Caption = filepath.Base(path)
+			b.api.Send(doc)
+			return
+		}
+		defer os.Remove(png)
+		if info, err = os.Stat(png); err != nil {
+			return
+		}
+		photoPath = png
+	}
+
+	if info.Size() > maxPhotoSize {
+		b.api.Send(tgbotapi.NewMessage(chatID, b.t("image_too_large",
+			filepath.Base(path), formatSize(info.Size()), formatSize(maxPhotoSize))))
+		return
+	}
+
+	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FilePath(photoPath))
+	photo.Caption = filepath.Base(path)
+	if _, err := b.api.Send(photo); err != nil {
+		log.Printf("Failed to send image %s: %v", path, err)
+	}
+}
+
+// rasterizeSVG converts an SVG to a temporary PNG with rsvg-convert,
+// returning the PNG's path for the caller to remove
+func rasterizeSVG(path string) (string, error) {
+	tmp, err := os.CreateTemp("", "omnik-image-*.png")
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if output, err := exec.CommandContext(ctx, "rsvg-convert", "-o", tmp.Name(), path).CombinedOutput(); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("rsvg-convert: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return tmp.Name(), nil
+}
@@ -0,0 +1,63 @@
+package bot
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Limits for /log
+const (
+	defaultLogLines = 50
+	maxLogLines     = 500
+	logChunkSize    = 64 * 1024
+)
+
+// tailLines returns up to the last n lines of the file at path, reading
+// backwards in chunks so large logs aren't loaded whole
+func tailLines(path string, n int) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf []byte
+	offset := info.Size()
+	for offset > 0 && strings.Count(string(buf), "\n") <= n {
+		size := int64(logChunkSize)
+		if offset < size {
+			size = offset
+		}
+		offset -= size
+
+		chunk := make([]byte, size)
+		if _, err := file.ReadAt(chunk, offset); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read log: %w", err)
+		}
+		buf = append(chunk, buf...)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(buf), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// formatLogTail joins log lines, dropping the oldest until the result fits
+// in a code block
+func formatLogTail(lines []string) string {
+	text := strings.Join(lines, "\n")
+	for len(lines) > 1 && telegramLen(text) > codeBlockLimit {
+		lines = lines[1:]
+		text = strings.Join(lines, "\n")
+	}
+	return text
+}
@@ -0,0 +1,194 @@
+package bot
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// markdownV2Escaper escapes every character MarkdownV2 reserves outside
+// code entities
+var markdownV2Escaper = strings.NewReplacer(
+	"\\", "\\\\", "_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]",
+	"(", "\\(", ")", "\\)", "~", "\\~", "`", "\\`", ">", "\\>",
+	"#", "\\#", "+", "\\+", "-", "\\-", "=", "\\=", "|", "\\|",
+	"{", "\\{", "}", "\\}", ".", "\\.", "!", "\\!",
+)
+
+// codeBlockEscaper escapes the characters MarkdownV2 reserves inside code
+// and pre entities
+var codeBlockEscaper = strings.NewReplacer("\\", "\\\\", "`", "\\`")
+
+// linkURLEscaper escapes the characters MarkdownV2 reserves inside a link's URL
+var linkURLEscaper = strings.NewReplacer("\\", "\\\\", ")", "\\)")
+
+// escapeMarkdownV2 escapes s so every character is shown literally
+func escapeMarkdownV2(s string) string {
+	return markdownV2Escaper.Replace(s)
+}
+
+var (
+	headingLine = regexp.MustCompile(`^#{1,6}\s+(.*)$`)
+	bulletLine  = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	quoteLine   = regexp.MustCompile(`^>\s?(.*)$`)
+)
+
+// renderMarkdownV2 converts the Markdown Claude writes into MarkdownV2:
+// ``` fences stay code blocks, inline code, bold, italics, strikethrough
+// and links keep their formatting, headings become bold, bullets become
+// "•" and quotes become block quotes. Everything else, including
+// unmatched delimiters, is escaped. A fence left open (e.g. mid-stream)
+// is closed.
+func renderMarkdownV2(s string) string {
+	parts := strings.Split(s, "```")
+
+	var out strings.Builder
+	for i, part := range parts {
+		if i%2 == 1 {
+			out.WriteString("```" + codeBlockEscaper.Replace(part) + "```")
+			continue
+		}
+		lines := strings.Split(part, "\n")
+		for j, line := range lines {
+			if j > 0 {
+				out.WriteByte('\n')
+			}
+			out.WriteString(renderMarkdownLine(line))
+		}
+	}
+	return out.String()
+}
+
+// renderMarkdownLine converts one line outside code blocks
+func renderMarkdownLine(line string) string {
+	if m := headingLine.FindStringSubmatch(line); m != nil {
+		return "*" + renderInline(strings.ReplaceAll(m[1], "**", "")) + "*"
+	}
+	if m := bulletLine.FindStringSubmatch(line); m != nil {
+		return m[1] + "• " + renderInline(m[2])
+	}
+	if m := quoteLine.FindStringSubmatch(line); m != nil {
+		return ">" + renderInline(m[1])
+	}
+	return renderInline(line)
+}
+
+// renderInline converts inline Markdown within a line
+func renderInline(s string) string {
+	var out strings.Builder
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		switch {
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				out.WriteString("`" + codeBlockEscaper.Replace(rest[1:1+end]) + "`")
+				i += end + 2
+				continue
+			}
+		case strings.HasPrefix(rest, "**") || strings.HasPrefix(rest, "__"):
+			if inner, n, ok := delimited(rest, rest[:2]); ok {
+				out.WriteString("*" + renderInline(inner) + "*")
+				i += n
+				continue
+			}
+		case strings.HasPrefix(rest, "~~"):
+			if inner, n, ok := delimited(rest, "~~"); ok {
+				out.WriteString("~" + renderInline(inner) + "~")
+				i += n
+				continue
+			}
+		case rest[0] == '*' || rest[0] == '_':
+			// snake_case identifiers aren't italics
+			if inner, n, ok := delimited(rest, rest[:1]); ok && (rest[0] == '*' || wordBoundary(s, i, i+n)) {
+				out.WriteString("_" + renderInline(inner) + "_")
+				i += n
+				continue
+			}
+		case rest[0] == '[':
+			if text, url, n, ok := parseLink(rest); ok {
+				out.WriteString("[" + renderInline(text) + "](" + linkURLEscaper.Replace(url) + ")")
+				i += n
+				continue
+			}
+		}
+
+		_, size := utf8.DecodeRuneInString(rest)
+		out.WriteString(escapeMarkdownV2(rest[:size]))
+		i += size
+	}
+	return out.String()
+}
+
+// delimited reports whether s opens a span with delim that is closed later
+// on, returning the text between and the length of the whole span. The
+// text may not be empty or start or end with a space.
+func delimited(s, delim string) (string, int, bool) {
+	end := strings.Index(s[len(delim):], delim)
+	if end <= 0 {
+		return "", 0, false
+	}
+	inner := s[len(delim) : len(delim)+end]
+	if strings.TrimSpace(inner) != inner {
+		return "", 0, false
+	}
+	return inner, len(delim)*2 + end, true
+}
+
+// wordBoundary reports whether s[start:end] isn't part of a longer word
+func wordBoundary(s string, start, end int) bool {
+	if start > 0 {
+		if r, _ := utf8.DecodeLastRuneInString(s[:start]); isWordRune(r) {
+			return false
+		}
+	}
+	if end < len(s) {
+		if r, _ := utf8.DecodeRuneInString(s[end:]); isWordRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isWordRune reports whether r can be part of an identifier
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// parseLink parses a [text](url) link at the start of s
+func parseLink(s string) (text, url string, n int, ok bool) {
+	closeText := strings.Index(s, "](")
+	if closeText <= 1 || strings.ContainsAny(s[1:closeText], "[]") {
+		return "", "", 0, false
+	}
+	closeURL := strings.IndexByte(s[closeText+2:], ')')
+	if closeURL <= 0 {
+		return "", "", 0, false
+	}
+	url = s[closeText+2 : closeText+2+closeURL]
+	if strings.ContainsAny(url, " \t") {
+		return "", "", 0, false
+	}
+	return s[1:closeText], url, closeText + 3 + closeURL, true
+}
+
+// editMarkdown edits a message to text rendered as MarkdownV2, falling back
+// to plain text if the rendered text is too long or Telegram rejects it
+func (b *Bot) editMarkdown(chatID int64, messageID int, text string) error {
+	rendered := renderMarkdownV2(text)
+	if telegramLen(rendered) > 4096 { // Telegram's hard limit; escaping can grow text past telegramLimit
+		return b.editText(chatID, messageID, text)
+	}
+
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, rendered)
+	edit.ParseMode = tgbotapi.ModeMarkdownV2
+	_, err := b.api.Send(edit)
+	if err == nil || strings.Contains(err.Error(), "message is not modified") {
+		return nil
+	}
+	log.Printf("Failed to edit message as MarkdownV2, falling back to plain text: %v", err)
+	return b.editText(chatID, messageID, text)
+}
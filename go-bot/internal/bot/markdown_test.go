@@ -0,0 +1,75 @@
+package bot
+
+import "testing"
+
+func TestEscapeMarkdownV2ReservedCharacters(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"_", `\_`},
+		{"*", `\*`},
+		{"[", `\[`},
+		{"]", `\]`},
+		{"(", `\(`},
+		{")", `\)`},
+		{"~", `\~`},
+		{"`", "\\`"},
+		{">", `\>`},
+		{"#", `\#`},
+		{"+", `\+`},
+		{"-", `\-`},
+		{"=", `\=`},
+		{"|", `\|`},
+		{"{", `\{`},
+		{"}", `\}`},
+		{".", `\.`},
+		{"!", `\!`},
+		{`\`, `\\`},
+		{"plain text", "plain text"},
+		{"v1.2 (beta)!", `v1\.2 \(beta\)\!`},
+	}
+
+	for _, tt := range tests {
+		if got := escapeMarkdownV2(tt.in); got != tt.want {
+			t.Errorf("escapeMarkdownV2(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRenderMarkdownV2(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain", "Done.", `Done\.`},
+		{"bold", "**bold** text", "*bold* text"},
+		{"underscore bold", "__bold__", "*bold*"},
+		{"italic star", "*italic*", "_italic_"},
+		{"italic underscore", "_italic_", "_italic_"},
+		{"snake case", "use snake_case_name here", `use snake\_case\_name here`},
+		{"strikethrough", "~~gone~~", "~gone~"},
+		{"inline code", "run `go test ./...` now", "run `go test ./...` now"},
+		{"inline code backtick escape", "`a\\b`", "`a\\\\b`"},
+		{"link", "[docs](https://example.com/a_b)", "[docs](https://example.com/a_b)"},
+		{"link url escapes", "[x](https://example.com/a\\b)", "[x](https://example.com/a\\\\b)"},
+		{"heading", "## Summary", "*Summary*"},
+		{"bullet", "- item one", "• item one"},
+		{"nested bullet", "  * item", "  • item"},
+		{"numbered", "1. first", `1\. first`},
+		{"quote", "> quoted", ">quoted"},
+		{"unclosed bold", "**open", `\*\*open`},
+		{"spaced stars", "2 * 3 * 4", `2 \* 3 \* 4`},
+		{"nested italic in bold", "**a _b_ c**", "*a _b_ c*"},
+		{"code block", "```go\nx := a_b * 2\n```", "```go\nx := a_b * 2\n```"},
+		{"code block escapes", "```\na\\b `c`\n```", "```\na\\\\b \\`c\\`\n```"},
+		{"open fence", "```\npartial", "```\npartial```"},
+		{"text around code", "See:\n```\nls\n```\nDone!", "See:\n```\nls\n```\nDone\\!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderMarkdownV2(tt.in); got != tt.want {
+				t.Errorf("renderMarkdownV2(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mcpConfig is the subset of .mcp.json the bot understands
+type mcpConfig struct {
+	MCPServers map[string]mcpServer `json:"mcpServers"`
+}
+
+// mcpServer describes a single MCP server entry
+type mcpServer struct {
+	Type    string            `json:"type,omitempty"` // stdio, http or sse
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// transport returns the server's transport, inferring stdio for command entries
+func (s mcpServer) transport() string {
+	if s.Type != "" {
+		return s.Type
+	}
+	if s.Command != "" {
+		return "stdio"
+	}
+	return "unknown"
+}
+
+// mcpConfigPath returns the .mcp.json path for a working directory
+func mcpConfigPath(dir string) string {
+	return filepath.Join(dir, ".mcp.json")
+}
+
+// loadMCPConfig reads and parses .mcp.json from dir
+func loadMCPConfig(dir string) (*mcpConfig, error) {
+	data, err := os.ReadFile(mcpConfigPath(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg mcpConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid .mcp.json: %w", err)
+	}
+	return &cfg, nil
+}
+
+// formatMCPConfig renders a readable summary of the configured servers.
+// Env and header values are left out since they often hold secrets.
+func (b *Bot) formatMCPConfig(path string, cfg *mcpConfig) string {
+	if len(cfg.MCPServers) == 0 {
+		return b.t("mcp_none", path)
+	}
+
+	names := make([]string, 0, len(cfg.MCPServers))
+	for name := range cfg.MCPServers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var text strings.Builder
+	text.WriteString(b.t("mcp_servers", len(names), path) + "\n\n")
+	for _, name := range names {
+		server := cfg.MCPServers[name]
+		text.WriteString(fmt.Sprintf("🔌 %s (%s)\n", name, server.transport()))
+		if server.URL != "" {
+			text.WriteString("   " + b.t("mcp_url", server.URL) + "\n")
+		}
+		if server.Command != "" {
+			text.WriteString("   " + b.t("mcp_command", strings.TrimSpace(server.Command+" "+strings.Join(server.Args, " "))) + "\n")
+		}
+		if len(server.Env) > 0 {
+			text.WriteString("   " + b.t("mcp_env", strings.Join(sortedKeys(server.Env), ", ")) + "\n")
+		}
+		if len(server.Headers) > 0 {
+			text.WriteString("   " + b.t("mcp_headers", strings.Join(sortedKeys(server.Headers), ", ")) + "\n")
+		}
+		text.WriteString("\n")
+	}
+	return text.String()
+}
+
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// mcpProbeTimeout bounds how long /mcptest waits on a server
+const mcpProbeTimeout = 5 * time.Second
+
+// mcpStartupGrace is how long a stdio server must stay up to count as started
+const mcpStartupGrace = 2 * time.Second
+
+// probeMCPServer checks that a server is reachable (http/sse) or can be
+// started (stdio). Returns a short description of what was verified.
+func (b *Bot) probeMCPServer(ctx context.Context, dir string, server mcpServer) (string, error) {
+	switch server.transport() {
+	case "http", "sse":
+		return b.probeMCPURL(ctx, server)
+	case "stdio":
+		return b.probeMCPCommand(ctx, dir, server)
+	default:
+		return "", fmt.Errorf("unknown transport %q", server.Type)
+	}
+}
+
+// probeMCPURL sends a GET to the server URL. Any response below 500 means
+// the endpoint is up; MCP endpoints often reject a bare GET with 4xx.
+func (b *Bot) probeMCPURL(ctx context.Context, server mcpServer) (string, error) {
+	if server.URL == "" {
+		return "", fmt.Errorf("no url configured")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mcpProbeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid url: %w", err)
+	}
+	for key, value := range server.Headers {
+		req.Header.Set(key, os.ExpandEnv(value))
+	}
+	if server.transport() == "sse" {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return "", fmt.Errorf("server error: %s", resp.Status)
+	}
+	return b.t("mcp_reachable", resp.Status), nil
+}
+
+// probeMCPCommand starts a stdio server and stops it again. A server that
+// stays up for mcpStartupGrace, or exits cleanly, counts as working.
+func (b *Bot) probeMCPCommand(ctx context.Context, dir string, server mcpServer) (string, error) {
+	if server.Command == "" {
+		return "", fmt.Errorf("no command configured")
+	}
+	path, err := exec.LookPath(server.Command)
+	if err != nil {
+		return "", fmt.Errorf("command not found: %s", server.Command)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, server.Args...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	for key, value := range server.Env {
+		cmd.Env = append(cmd.Env, key+"="+os.ExpandEnv(value))
+	}
+	cmd.Stderr = &stderr
+
+	// An open stdin keeps servers that wait for requests running
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return "", err
+	}
+	defer stdin.Close()
+
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to start: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			detail := strings.TrimSpace(stderr.String())
+			if detail != "" {
+				return "", fmt.Errorf("exited: %v\n%s", err, truncateRunes(detail, 500))
+			}
+			return "", fmt.Errorf("exited: %v", err)
+		}
+		return b.t("mcp_exited_cleanly", path), nil
+	case <-time.After(mcpStartupGrace):
+		cancel()
+		<-done
+		return b.t("mcp_started", path), nil
+	}
+}
@@ -0,0 +1,30 @@
+package bot
+
+import (
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// observerPromptChars is how much of the prompt the observer copy keeps
+const observerPromptChars = 500
+
+// mirrorToObserver posts a condensed copy of a completed query to the
+// observer chat, if one is configured
+func (b *Bot) mirrorToObserver(sessionName, prompt, response string) {
+	if b.observerChatID == 0 {
+		return
+	}
+
+	if len([]rune(prompt)) > observerPromptChars {
+		prompt = truncateRunes(prompt, observerPromptChars) + "…"
+	}
+	text := b.t("observer_mirror", sessionName, prompt, response)
+	if telegramLen(text) > telegramLimit {
+		text = truncateTelegram(text, telegramLimit) + "\n\n" + b.t("truncated")
+	}
+
+	if _, err := b.api.Send(tgbotapi.NewMessage(b.observerChatID, text)); err != nil {
+		log.Printf("Failed to mirror query to observer chat: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/drew/omnik-bot/internal/claude"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// permissionTimeout is how long a tool permission prompt waits for an
+// answer before denying
+const permissionTimeout = 5 * time.Minute
+
+// pendingPermission is a tool use waiting for the user to allow or deny it
+type pendingPermission struct {
+	chatID   int64
+	decision chan bool
+}
+
+// askPermission asks the user whether Claude may use a tool and blocks
+// until they answer, the query is cancelled or the prompt times out
+func (b *Bot) askPermission(ctx context.Context, chatID int64, req claude.PermissionRequest) bool {
+	b.permMu.Lock()
+	b.permSeq++
+	id := fmt.Sprintf("%d", b.permSeq)
+	decision := make(chan bool, 1)
+	b.pendingPerms[id] = pendingPermission{chatID: chatID, decision: decision}
+	b.permMu.Unlock()
+
+	defer func() {
+		b.permMu.Lock()
+		delete(b.pendingPerms, id)
+		b.permMu.Unlock()
+	}()
+
+	input := describeToolInput(req.Input)
+	if input == "" {
+		input = b.t("no_input")
+	}
+	prompt := tgbotapi.NewMessage(chatID, b.t("permission_prompt", req.ToolName, input))
+	prompt.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(b.t("button_allow"), "perm_allow:"+id),
+			tgbotapi.NewInlineKeyboardButtonData(b.t("button_deny"), "perm_deny:"+id),
+		),
+	)
+	sent, err := b.api.Send(prompt)
+	if err != nil {
+		log.Printf("Failed to send permission prompt: %v", err)
+		return false
+	}
+
+	timeout := time.NewTimer(permissionTimeout)
+	defer timeout.Stop()
+
+	select {
+	case allow := <-decision:
+		return allow
+	case <-ctx.Done():
+		b.editText(chatID, sent.MessageID, sent.Text+"\n\n"+b.t("permission_stopped"))
+	case <-timeout.C:
+		b.editText(chatID, sent.MessageID, sent.Text+"\n\n"+b.t("permission_timed_out"))
+	}
+	return false
+}
+
+// takePermission removes and returns the pending permission with the given ID
+func (b *Bot) takePermission(id string, chatID int64) (pendingPermission, bool) {
+	b.permMu.Lock()
+	defer b.permMu.Unlock()
+
+	pending, ok := b.pendingPerms[id]
+	if !ok || pending.chatID != chatID {
+		return pendingPermission{}, false
+	}
+	delete(b.pendingPerms, id)
+	return pending, true
+}
+
+// pendingPermissionCount returns how many permission prompts in chatID
+// are waiting for an answer
+func (b *Bot) pendingPermissionCount(chatID int64) int {
+	b.permMu.Lock()
+	defer b.permMu.Unlock()
+
+	count := 0
+	for _, pending := range b.pendingPerms {
+		if pending.chatID == chatID {
+			count++
+		}
+	}
+	return count
+}
+
+// describeToolInput summarizes what a tool is about to do, or returns ""
+// if it has no input
+func describeToolInput(input map[string]interface{}) string {
+	for _, key := range []string{"command", "file_path", "path", "pattern", "url"} {
+		if v, ok := input[key].(string); ok && v != "" {
+			return truncateRunes(v, 1000)
+		}
+	}
+
+	data, err := json.MarshalIndent(input, "", "  ")
+	if err != nil || len(input) == 0 {
+		return ""
+	}
+	return truncateRunes(string(data), 1000)
+}
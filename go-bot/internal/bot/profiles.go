@@ -0,0 +1,206 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/drew/omnik-bot/internal/claude"
+)
+
+// Profile bundles the model, permission mode and tools used for queries
+type Profile struct {
+	Model          string   `json:"model,omitempty"`
+	PermissionMode string   `json:"permission_mode,omitempty"`
+	AllowedTools   []string `json:"allowed_tools,omitempty"` // Empty = default tools
+}
+
+// builtinProfiles are always available; a profiles file may override them
+var builtinProfiles = map[string]Profile{
+	"safe": {
+		PermissionMode: "default",
+		AllowedTools:   []string{"Read", "Edit", "Glob", "Grep"},
+	},
+	"yolo": {
+		PermissionMode: "bypassPermissions",
+	},
+}
+
+// loadProfiles returns the built-in profiles merged with those defined in
+// the JSON file at path (if any)
+func loadProfiles(path string) (map[string]Profile, error) {
+	profiles := make(map[string]Profile, len(builtinProfiles))
+	for name, profile := range builtinProfiles {
+		profiles[name] = profile
+	}
+
+	if path == "" {
+		return profiles, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles file: %w", err)
+	}
+
+	var custom map[string]Profile
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return nil, fmt.Errorf("invalid profiles file: %w", err)
+	}
+	for name, profile := range custom {
+		profiles[strings.ToLower(name)] = profile
+	}
+
+	return profiles, nil
+}
+
+// describeProfile renders a profile's settings on one line
+func (b *Bot) describeProfile(p Profile) string {
+	model := p.Model
+	if model == "" {
+		model = b.t("default_model")
+	}
+	permissionMode := p.PermissionMode
+	if permissionMode == "" {
+		permissionMode = "bypassPermissions"
+	}
+	tools := b.t("default_tools")
+	if len(p.AllowedTools) > 0 {
+		tools = strings.Join(p.AllowedTools, ", ")
+	}
+	return fmt.Sprintf("%s · %s · %s", model, permissionMode, tools)
+}
+
+// chatProfile returns the active profile name and settings for a chat
+func (b *Bot) chatProfile(chatID int64) (string, Profile, bool) {
+	b.chatMu.RLock()
+	defer b.chatMu.RUnlock()
+
+	name, ok := b.chatProfiles[chatID]
+	if !ok {
+		return "", Profile{}, false
+	}
+	profile, ok := b.profiles[name]
+	return name, profile, ok
+}
+
+// setChatProfile activates a profile for a chat; an empty name clears it
+func (b *Bot) setChatProfile(chatID int64, name string) {
+	b.chatMu.Lock()
+	defer b.chatMu.Unlock()
+
+	if name == "" {
+		delete(b.chatProfiles, chatID)
+	} else {
+		b.chatProfiles[chatID] = name
+	}
+	b.saveChatState()
+}
+
+// chatModelNames are the models /model accepts
+var chatModelNames = []string{"sonnet", "opus", "haiku"}
+
+// isChatModel reports whether /model accepts name
+func isChatModel(name string) bool {
+	for _, model := range chatModelNames {
+		if model == name {
+			return true
+		}
+	}
+	return false
+}
+
+// chatModel returns the model chosen with /model for a chat ("" = none)
+func (b *Bot) chatModel(chatID int64) string {
+	b.chatMu.RLock()
+	defer b.chatMu.RUnlock()
+	return b.chatModels[chatID]
+}
+
+// setChatModel sets a chat's model override; an empty name clears it
+func (b *Bot) setChatModel(chatID int64, model string) {
+	b.chatMu.Lock()
+	defer b.chatMu.Unlock()
+
+	if model == "" {
+		delete(b.chatModels, chatID)
+	} else {
+		b.chatModels[chatID] = model
+	}
+	b.saveChatState()
+}
+
+// profileNames returns the available profile names in sorted order
+func (b *Bot) profileNames() []string {
+	names := make([]string, 0, len(b.profiles))
+	for name := range b.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseToolList splits a /tools argument into tool names. Commas separate
+// tools when present, so rules like "Bash(git log:*)" keep their spaces;
+// otherwise any whitespace does.
+func parseToolList(s string) []string {
+	parts := strings.Fields(s)
+	if strings.Contains(s, ",") {
+		parts = strings.Split(s, ",")
+	}
+
+	var tools []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			tools = append(tools, part)
+		}
+	}
+	return tools
+}
+
+// toolName returns the tool a rule applies to, e.g. "Bash" for
+// "Bash(git log:*)"
+func toolName(rule string) string {
+	name, _, _ := strings.Cut(rule, "(")
+	return strings.TrimSpace(name)
+}
+
+// narrowTools returns the session's tools that the profile also allows, so
+// a session can only restrict the profile. A session rule is kept when the
+// profile lists it or its whole tool. An empty profile list allows all.
+func narrowTools(session, profile []string) []string {
+	if len(profile) == 0 {
+		return session
+	}
+
+	allowed := make(map[string]bool, len(profile))
+	for _, rule := range profile {
+		allowed[rule] = true
+	}
+
+	narrowed := []string{}
+	for _, rule := range session {
+		if allowed[rule] || allowed[toolName(rule)] {
+			narrowed = append(narrowed, rule)
+		}
+	}
+	return narrowed
+}
+
+// disallowedTools returns the built-in tools not covered by allowed
+func disallowedTools(allowed []string) []string {
+	covered := make(map[string]bool, len(allowed))
+	for _, rule := range allowed {
+		covered[toolName(rule)] = true
+	}
+
+	var denied []string
+	for _, tool := range claude.BuiltinTools {
+		if !covered[tool] {
+			denied = append(denied, tool)
+		}
+	}
+	return denied
+}
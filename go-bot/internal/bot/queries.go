@@ -0,0 +1,210 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// runningQuery tracks an in-flight Claude query so it can be stopped
+type runningQuery struct {
+	stop   chan struct{}
+	once   sync.Once
+	reason string
+	msg    *tgbotapi.Message // Queued message the query was reserved for
+}
+
+// queuedPrompt is a prompt waiting for the chat's running query to finish
+type queuedPrompt struct {
+	msg    *tgbotapi.Message
+	prompt string
+}
+
+// Stop signals the query to stop. Safe to call more than once or
+// concurrently; only the first reason is kept.
+func (q *runningQuery) Stop(reason string) {
+	q.once.Do(func() {
+		q.reason = reason
+		close(q.stop)
+	})
+}
+
+// stopReason returns the stop reason and true once the query has been stopped
+func (q *runningQuery) stopReason() (string, bool) {
+	select {
+	case <-q.stop:
+		return q.reason, true
+	default:
+		return "", false
+	}
+}
+
+// registerQuery records a running query for msg's chat. If the chat
+// already has one, the prompt is queued behind it instead: registerQuery
+// returns nil and the 1-based queue position, or 0 if the queue is full.
+// Once the bot is shutting down it returns nil and -1.
+//
+// A returned query is counted in queryWG, and the caller must call
+// queryWG.Done when it finishes. Adding under stopMutex, after the
+// shutdown check, orders every Add before Shutdown's Wait.
+func (b *Bot) registerQuery(msg *tgbotapi.Message, prompt string) (*runningQuery, int) {
+	b.stopMutex.Lock()
+	defer b.stopMutex.Unlock()
+
+	if b.shuttingDown {
+		return nil, -1
+	}
+
+	chatID := msg.Chat.ID
+	if running, exists := b.stopChannels[chatID]; exists {
+		// unregisterQuery reserved the slot for this queued message
+		if running.msg == msg {
+			b.queryWG.Add(1)
+			return running, 0
+		}
+		if len(b.queuedPrompts[chatID]) >= b.queueDepth {
+			return nil, 0
+		}
+		b.queuedPrompts[chatID] = append(b.queuedPrompts[chatID], queuedPrompt{msg: msg, prompt: prompt})
+		return nil, len(b.queuedPrompts[chatID])
+	}
+
+	query := &runningQuery{stop: make(chan struct{})}
+	b.stopChannels[chatID] = query
+	b.queryWG.Add(1)
+	return query, 0
+}
+
+// unregisterQuery removes the running query for chatID. If prompts are
+// queued, the slot is handed to the next one, which is returned for the
+// caller to run.
+func (b *Bot) unregisterQuery(chatID int64, query *runningQuery) (queuedPrompt, bool) {
+	b.stopMutex.Lock()
+	defer b.stopMutex.Unlock()
+
+	if b.stopChannels[chatID] != query {
+		return queuedPrompt{}, false
+	}
+	delete(b.stopChannels, chatID)
+
+	queue := b.queuedPrompts[chatID]
+	if len(queue) == 0 {
+		return queuedPrompt{}, false
+	}
+	next := queue[0]
+	if len(queue) == 1 {
+		delete(b.queuedPrompts, chatID)
+	} else {
+		b.queuedPrompts[chatID] = queue[1:]
+	}
+	b.stopChannels[chatID] = &runningQuery{stop: make(chan struct{}), msg: next.msg}
+	return next, true
+}
+
+// clearQueue drops the prompts queued for chatID and returns how many there were
+func (b *Bot) clearQueue(chatID int64) int {
+	b.stopMutex.Lock()
+	defer b.stopMutex.Unlock()
+
+	n := len(b.queuedPrompts[chatID])
+	delete(b.queuedPrompts, chatID)
+	return n
+}
+
+// hasRunningQuery reports whether chatID has a query in flight
+func (b *Bot) hasRunningQuery(chatID int64) bool {
+	b.stopMutex.Lock()
+	defer b.stopMutex.Unlock()
+
+	_, ok := b.stopChannels[chatID]
+	return ok
+}
+
+// registerExec records a running /exec command for chatID, counted in
+// queryWG like a query. Returns nil if the chat already runs one or the
+// bot is shutting down.
+func (b *Bot) registerExec(chatID int64) *runningQuery {
+	b.stopMutex.Lock()
+	defer b.stopMutex.Unlock()
+
+	if _, exists := b.runningExecs[chatID]; exists || b.shuttingDown {
+		return nil
+	}
+	run := &runningQuery{stop: make(chan struct{})}
+	b.runningExecs[chatID] = run
+	b.queryWG.Add(1)
+	return run
+}
+
+// unregisterExec removes the running /exec command for chatID
+func (b *Bot) unregisterExec(chatID int64, run *runningQuery) {
+	b.stopMutex.Lock()
+	defer b.stopMutex.Unlock()
+
+	if b.runningExecs[chatID] == run {
+		delete(b.runningExecs, chatID)
+	}
+}
+
+// stopQuery stops the running query and /exec command for chatID,
+// reporting whether there was either
+func (b *Bot) stopQuery(chatID int64, reason string) bool {
+	b.stopMutex.Lock()
+	defer b.stopMutex.Unlock()
+
+	query, ok := b.stopChannels[chatID]
+	if ok {
+		query.Stop(reason)
+	}
+	run, running := b.runningExecs[chatID]
+	if running {
+		run.Stop(reason)
+	}
+	return ok || running
+}
+
+// stopAllQueries stops every running query and /exec command and returns
+// how many were stopped
+func (b *Bot) stopAllQueries(reason string) int {
+	b.stopMutex.Lock()
+	defer b.stopMutex.Unlock()
+
+	// Queued prompts would otherwise start as soon as their query stops
+	b.queuedPrompts = make(map[int64][]queuedPrompt)
+	for _, query := range b.stopChannels {
+		query.Stop(reason)
+	}
+	for _, run := range b.runningExecs {
+		run.Stop(reason)
+	}
+	return len(b.stopChannels) + len(b.runningExecs)
+}
+
+// Shutdown stops every running query, refuses new ones and waits for the
+// running ones to finish, so no Claude process is left behind. It gives up
+// when ctx is done.
+func (b *Bot) Shutdown(ctx context.Context) error {
+	b.stopMutex.Lock()
+	b.shuttingDown = true
+	b.stopMutex.Unlock()
+
+	if count := b.stopAllQueries(b.t("shutting_down")); count > 0 {
+		log.Printf("Waiting for %d running quer%s to stop...", count, pluralSuffix(count, "y", "ies"))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		b.queryWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("queries still running at shutdown: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,47 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// withinSandbox reports whether path, once cleaned and with symlinks
+// resolved, is the workspace root or inside it
+func (b *Bot) withinSandbox(path string) bool {
+	root := resolveSymlinks(filepath.Clean(b.workspaceRoot))
+	path = resolveSymlinks(filepath.Clean(path))
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// checkSandbox tells the chat and returns false if path is outside the sandbox
+func (b *Bot) checkSandbox(chatID int64, path string) bool {
+	if b.withinSandbox(path) {
+		return true
+	}
+	b.api.Send(tgbotapi.NewMessage(chatID, b.t("outside_sandbox", path, b.workspaceRoot)))
+	return false
+}
+
+// resolveSymlinks resolves symlinks in path. Components that don't exist
+// yet are kept as they are under their nearest existing ancestor.
+func resolveSymlinks(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	} else if !os.IsNotExist(err) {
+		return path
+	}
+
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path
+	}
+	return filepath.Join(resolveSymlinks(parent), filepath.Base(path))
+}
@@ -0,0 +1,43 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// scheduleCheckInterval is how often the scheduler looks for due jobs
+const scheduleCheckInterval = 30 * time.Second
+
+// schedulerLoop runs due scheduled prompts until ctx is cancelled
+func (b *Bot) schedulerLoop(ctx context.Context) {
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			due, err := b.schedules.TakeDue(now)
+			if err != nil {
+				log.Printf("Warning: %v", err)
+			}
+			for _, job := range due {
+				log.Printf("⏰ Running scheduled job %d in chat %d", job.ID, job.ChatID)
+				b.api.Send(tgbotapi.NewMessage(job.ChatID, b.t("job_running", job.ID, job.Spec, job.Prompt)))
+
+				// Run through the normal query path as if the user had sent it
+				msg := &tgbotapi.Message{
+					From: &tgbotapi.User{ID: job.UserID},
+					Chat: &tgbotapi.Chat{ID: job.ChatID},
+					Text: job.Prompt,
+					Date: int(now.Unix()),
+				}
+				go b.forwardToClaude(ctx, msg, job.Prompt)
+			}
+		}
+	}
+}
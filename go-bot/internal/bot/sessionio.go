@@ -0,0 +1,145 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxImportSize caps the size of an uploaded session index
+const maxImportSize = 1 << 20
+
+// exportSessions sends the session index as a JSON document
+func (b *Bot) exportSessions(chatID int64) error {
+	data, err := b.sessionManager.Export()
+	if err != nil {
+		return fmt.Errorf("failed to export sessions: %w", err)
+	}
+
+	name := fmt.Sprintf("omnik-sessions-%s.json", time.Now().Format("20060102-150405"))
+	doc := tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{Name: name, Bytes: data})
+	count := len(b.sessionManager.List())
+	doc.Caption = b.tn("session_count", count)
+	if _, err := b.api.Send(doc); err != nil {
+		return fmt.Errorf("failed to send export: %w", err)
+	}
+	return nil
+}
+
+// handleDocument handles an uploaded file. Only documents captioned with a
+// command that expects a file are acted on; others are ignored.
+func (b *Bot) handleDocument(ctx context.Context, msg *tgbotapi.Message) {
+	fields := strings.Fields(msg.Caption)
+	if len(fields) == 0 {
+		return
+	}
+	command := strings.SplitN(strings.TrimPrefix(fields[0], "/"), "@", 2)[0]
+	if !strings.HasPrefix(fields[0], "/") || command != "importsessions" {
+		return
+	}
+
+	outcome := "handled"
+	defer func() { b.audit(msg.From.ID, msg.Chat.ID, "command", msg.Caption, outcome) }()
+
+	replace := false
+	if len(fields) > 1 {
+		switch fields[1] {
+		case "merge":
+		case "replace":
+			replace = true
+		default:
+			outcome = "invalid mode"
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("import_usage")))
+			return
+		}
+	}
+
+	data, err := b.downloadDocument(ctx, msg.Document)
+	if err != nil {
+		outcome = fmt.Sprintf("error: %v", err)
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+		return
+	}
+
+	// Validate before asking, so the confirmation only offers a real import
+	count, err := countImportSessions(data)
+	if err != nil {
+		outcome = fmt.Sprintf("error: %v", err)
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+		return
+	}
+
+	prompt := b.tn("import_merge_prompt", count, msg.Document.FileName)
+	label := b.t("button_merge")
+	if replace {
+		prompt = b.t("import_replace_prompt", len(b.sessionManager.List()), count, msg.Document.FileName)
+		label = b.t("button_replace")
+	}
+
+	b.askConfirm(msg.Chat.ID, prompt, label, func() {
+		n, err := b.sessionManager.Import(data, replace)
+		if err != nil {
+			b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("error", err)))
+			return
+		}
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.tn("imported_sessions", n)))
+	})
+}
+
+// countImportSessions validates a session index without applying it and
+// returns the number of sessions it holds
+func countImportSessions(data []byte) (int, error) {
+	var stored struct {
+		Sessions map[string]interface{} `json:"sessions"`
+	}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return 0, fmt.Errorf("invalid session index: %w", err)
+	}
+	if stored.Sessions == nil {
+		return 0, fmt.Errorf("invalid session index: no sessions field")
+	}
+	return len(stored.Sessions), nil
+}
+
+// downloadDocument fetches an uploaded document's contents from Telegram
+func (b *Bot) downloadDocument(ctx context.Context, doc *tgbotapi.Document) ([]byte, error) {
+	return b.downloadTelegramFile(ctx, doc.FileID, doc.FileSize, maxImportSize)
+}
+
+// downloadTelegramFile fetches the contents of a file sent to the bot,
+// refusing files larger than maxSize
+func (b *Bot) downloadTelegramFile(ctx context.Context, fileID string, size int, maxSize int64) ([]byte, error) {
+	if int64(size) > maxSize {
+		return nil, fmt.Errorf("file too large (%s, max %s)", formatSize(int64(size)), formatSize(maxSize))
+	}
+
+	url, err := b.api.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// The URL contains the bot token, so don't include it in the error
+		log.Printf("Failed to download file %s", fileID)
+		return nil, fmt.Errorf("failed to download file")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download file: status %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxSize))
+}
@@ -0,0 +1,118 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// updatePollTimeout is the long-poll timeout in seconds. A healthy poll
+	// returns at least this often, even when there are no updates.
+	updatePollTimeout = 60
+
+	// updateStallTimeout is how long a single poll may stay in flight before
+	// the watchdog gives up on it and starts a fresh poll loop
+	updateStallTimeout = 3 * time.Minute
+)
+
+// updatePoller long-polls Telegram for updates. Unlike GetUpdatesChan it
+// can be restarted: a poll stuck on a dead connection is abandoned and a new
+// loop resumes from the last delivered offset.
+type updatePoller struct {
+	api     *tgbotapi.BotAPI
+	updates chan tgbotapi.Update
+
+	mu         sync.Mutex
+	offset     int
+	generation int       // Bumped on restart; older loops exit
+	inFlight   bool      // A GetUpdates call is outstanding
+	pollStart  time.Time // When the outstanding call started
+}
+
+// newUpdatePoller creates a poller delivering to a buffered channel
+func newUpdatePoller(api *tgbotapi.BotAPI) *updatePoller {
+	return &updatePoller{
+		api:     api,
+		updates: make(chan tgbotapi.Update, api.Buffer),
+	}
+}
+
+// run starts polling and watches for stalls until ctx is done
+func (p *updatePoller) run(ctx context.Context) {
+	go p.poll(ctx, 0)
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			if p.inFlight && time.Since(p.pollStart) > updateStallTimeout {
+				log.Printf("No response from Telegram for %s, restarting update loop", time.Since(p.pollStart).Round(time.Second))
+				p.generation++
+				p.inFlight = false
+				go p.poll(ctx, p.generation)
+			}
+			p.mu.Unlock()
+		}
+	}
+}
+
+// poll runs one generation of the update loop
+func (p *updatePoller) poll(ctx context.Context, generation int) {
+	for ctx.Err() == nil {
+		p.mu.Lock()
+		if generation != p.generation {
+			p.mu.Unlock()
+			return
+		}
+		config := tgbotapi.NewUpdate(p.offset)
+		config.Timeout = updatePollTimeout
+		p.inFlight = true
+		p.pollStart = time.Now()
+		p.mu.Unlock()
+
+		updates, err := p.api.GetUpdates(config)
+
+		p.mu.Lock()
+		if generation != p.generation {
+			// The watchdog replaced us; the new loop refetches from offset
+			p.mu.Unlock()
+			return
+		}
+		p.inFlight = false
+		var fresh []tgbotapi.Update
+		for _, update := range updates {
+			if update.UpdateID >= p.offset {
+				p.offset = update.UpdateID + 1
+				fresh = append(fresh, update)
+			}
+		}
+		p.mu.Unlock()
+
+		if err != nil {
+			log.Printf("Failed to get updates, retrying in 3 seconds: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(3 * time.Second):
+			}
+			continue
+		}
+
+		for _, update := range fresh {
+			select {
+			case p.updates <- update:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
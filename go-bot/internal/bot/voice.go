@@ -0,0 +1,185 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxVoiceSize is the largest voice or audio message transcribed; the
+// Bot API can't download bigger files anyway
+const maxVoiceSize = 20 << 20
+
+// transcribeTimeout bounds a single transcription
+const transcribeTimeout = 2 * time.Minute
+
+// Transcriber turns recorded speech into text
+type Transcriber interface {
+	Transcribe(ctx context.Context, audio []byte, filename string) (string, error)
+}
+
+// newTranscriber picks the speech-to-text backend from the config: an HTTP
+// endpoint, a local command, or nil when neither is set
+func newTranscriber(cfg Config) Transcriber {
+	switch {
+	case cfg.STTURL != "":
+		return &httpTranscriber{url: cfg.STTURL, apiKey: cfg.STTAPIKey, model: cfg.STTModel}
+	case cfg.STTCommand != "":
+		return &commandTranscriber{command: strings.Fields(cfg.STTCommand)}
+	default:
+		return nil
+	}
+}
+
+// httpTranscriber posts audio to an OpenAI-compatible transcription
+// endpoint (/v1/audio/transcriptions)
+type httpTranscriber struct {
+	url    string
+	apiKey string
+	model  string
+}
+
+func (t *httpTranscriber) Transcribe(ctx context.Context, audio []byte, filename string) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		return "", err
+	}
+	part.Write(audio)
+	if t.model != "" {
+		form.WriteField("model", t.model)
+	}
+	form.WriteField("response_format", "json")
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, &body)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if t.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+t.apiKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("transcription request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read transcription: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("transcription failed: status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("failed to parse transcription: %w", err)
+	}
+	return result.Text, nil
+}
+
+// commandTranscriber runs a local command (e.g. a whisper wrapper) with
+// the audio file's path as its last argument and reads the text from its
+// stdout
+type commandTranscriber struct {
+	command []string
+}
+
+func (t *commandTranscriber) Transcribe(ctx context.Context, audio []byte, filename string) (string, error) {
+	tmp, err := os.CreateTemp("", "omnik-voice-*-"+filepath.Base(filename))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(audio); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	args := append(t.command[1:len(t.command):len(t.command)], tmp.Name())
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.command[0], args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %v: %s", t.command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(output), nil
+}
+
+// handleVoice transcribes a voice or audio message, shows the
+// transcription, then sends it to Claude like a typed prompt
+func (b *Bot) handleVoice(ctx context.Context, msg *tgbotapi.Message) {
+	if b.transcriber == nil {
+		b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("voice_disabled")))
+		return
+	}
+
+	fileID, size, filename := "", 0, "voice.ogg"
+	if msg.Voice != nil {
+		fileID, size = msg.Voice.FileID, msg.Voice.FileSize
+	} else {
+		fileID, size = msg.Audio.FileID, msg.Audio.FileSize
+		if msg.Audio.FileName != "" {
+			filename = msg.Audio.FileName
+		}
+	}
+
+	sent, err := b.api.Send(tgbotapi.NewMessage(msg.Chat.ID, b.t("transcribing")))
+	if err != nil {
+		log.Printf("Failed to send transcribing message: %v", err)
+		return
+	}
+	fail := func(err error) {
+		b.audit(msg.From.ID, msg.Chat.ID, "voice", "", fmt.Sprintf("error: %v", err))
+		b.api.Send(tgbotapi.NewEditMessageText(msg.Chat.ID, sent.MessageID, b.t("error", err)))
+	}
+
+	audio, err := b.downloadTelegramFile(ctx, fileID, size, maxVoiceSize)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	transcribeCtx, cancel := context.WithTimeout(ctx, transcribeTimeout)
+	defer cancel()
+	text, err := b.transcriber.Transcribe(transcribeCtx, audio, filename)
+	if err != nil {
+		log.Printf("Transcription failed: %v", err)
+		fail(err)
+		return
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		fail(fmt.Errorf("no speech recognized"))
+		return
+	}
+
+	// Show what was heard before Claude starts on it
+	b.api.Send(tgbotapi.NewEditMessageText(msg.Chat.ID, sent.MessageID, b.t("transcribed", text)))
+	b.submitPrompt(ctx, msg, text)
+}
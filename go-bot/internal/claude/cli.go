@@ -4,16 +4,49 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os/exec"
+	"strings"
+	"time"
 )
 
+// DefaultAllowedTools are the common development tools allowed when a
+// request doesn't specify its own list
+var DefaultAllowedTools = []string{"Bash", "Read", "Write", "Edit", "Glob", "Grep"}
+
+// BuiltinTools are the Claude Code tools a request can disallow. In
+// bypassPermissions mode --allowed-tools restricts nothing, so limiting a
+// query to some tools means disallowing the rest of these.
+var BuiltinTools = []string{
+	"Bash", "BashOutput", "KillShell", "Read", "Write", "Edit", "MultiEdit",
+	"NotebookEdit", "Glob", "Grep", "LS", "WebFetch", "WebSearch", "Task",
+	"TodoWrite", "SlashCommand",
+}
+
+// DefaultMaxLineSize is the longest stream-json line accepted from the CLI.
+// Lines carrying large tool results or file contents easily exceed the
+// 64KB bufio.Scanner default.
+const DefaultMaxLineSize = 16 * 1024 * 1024
+
+// streamBufferBytes is how much parsed output may queue up between the
+// stdout reader and the consumer. Telegram edits are rate limited, so the
+// bot reads slowly; a deep buffer keeps us draining stdout so the CLI never
+// blocks on a full pipe. Once this much is queued the reader stops until
+// the consumer catches up, so a query holds at most this plus one message
+// (up to maxLineSize) in the queue, on top of the scanner's own buffer.
+const streamBufferBytes = 64 * 1024 * 1024
+
+// stderrTailLines is how much of stderr is reported when the CLI fails
+const stderrTailLines = 10
+
 // CLIClient wraps the Claude CLI for executing queries
 type CLIClient struct {
 	model          string
 	permissionMode string
+	maxLineSize    int
 }
 
 // NewCLIClient creates a new CLI client
@@ -21,26 +54,125 @@ func NewCLIClient(model, permissionMode string) *CLIClient {
 	return &CLIClient{
 		model:          model,
 		permissionMode: permissionMode,
+		maxLineSize:    DefaultMaxLineSize,
 	}
 }
 
+// SetMaxLineSize changes the longest output line accepted from the CLI
+func (c *CLIClient) SetMaxLineSize(n int) {
+	c.maxLineSize = n
+}
+
+// bufferStream forwards responses from in, queueing up to limit bytes of
+// them while the consumer lags. The queue never refuses a message while
+// empty, so one larger than limit still goes through. The returned channel
+// closes once in is closed and drained, or when ctx is done.
+func bufferStream(ctx context.Context, in <-chan StreamResponse, limit int) <-chan StreamResponse {
+	out := make(chan StreamResponse)
+	go func() {
+		defer close(out)
+		var queue []StreamResponse
+		queued := 0
+		for in != nil || len(queue) > 0 {
+			// A nil channel disables its case: stop reading when full, and
+			// only offer a message when one is waiting
+			recv := in
+			if queued >= limit {
+				recv = nil
+			}
+			var send chan StreamResponse
+			var next StreamResponse
+			if len(queue) > 0 {
+				send, next = out, queue[0]
+			}
+
+			select {
+			case resp, ok := <-recv:
+				if !ok {
+					in = nil
+					continue
+				}
+				queue = append(queue, resp)
+				queued += responseSize(resp)
+			case send <- next:
+				queue[0] = StreamResponse{}
+				queue = queue[1:]
+				queued -= responseSize(next)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// responseSize approximates the memory a queued response holds
+func responseSize(resp StreamResponse) int {
+	return len(resp.Type) + len(resp.Data) + len(resp.Error) + len(resp.Code)
+}
+
 // Query executes a Claude query using the CLI directly
 func (c *CLIClient) Query(ctx context.Context, req QueryRequest) (<-chan StreamResponse, <-chan error) {
-	responseChan := make(chan StreamResponse, 10)
+	parsed := make(chan StreamResponse)
+	responseChan := bufferStream(ctx, parsed, streamBufferBytes)
 	errorChan := make(chan error, 1)
 
 	go func() {
-		defer close(responseChan)
+		defer close(parsed)
 		defer close(errorChan)
 
+		// A runaway query is killed after the request's timeout and reported
+		// in-stream, distinct from the caller cancelling
+		parent := ctx
+		if req.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, req.Timeout)
+			defer cancel()
+		}
+		defer func() {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) && parent.Err() == nil {
+				select {
+				case parsed <- StreamResponse{
+					Type:  "error",
+					Code:  "timeout",
+					Error: fmt.Sprintf("query timed out after %s", req.Timeout),
+				}:
+				case <-parent.Done():
+				}
+			}
+		}()
+
+		// Per-request permission mode and tools override the client defaults
+		permissionMode := c.permissionMode
+		if req.PermissionMode != "" {
+			permissionMode = req.PermissionMode
+		}
+		allowedTools := DefaultAllowedTools
+		if len(req.AllowedTools) > 0 {
+			allowedTools = req.AllowedTools
+		}
+
 		// Build CLI arguments
 		args := []string{
 			"--print",
 			"--output-format", "stream-json",
 			"--verbose", // Required for stream-json format
-			"--permission-mode", c.permissionMode,
-			// Allow common development tools
-			"--allowed-tools", "Bash", "Read", "Write", "Edit", "Glob", "Grep",
+			"--permission-mode", permissionMode,
+			"--allowed-tools",
+		}
+		args = append(args, allowedTools...)
+		if len(req.DisallowedTools) > 0 {
+			args = append(args, "--disallowed-tools")
+			args = append(args, req.DisallowedTools...)
+		}
+
+		// Permission prompts are answered over a stream-json stdin
+		interactive := req.OnPermission != nil && permissionMode != "bypassPermissions"
+		if interactive {
+			args = append(args,
+				"--input-format", "stream-json",
+				"--permission-prompt-tool", "stdio",
+			)
 		}
 
 		// Add model if specified
@@ -50,6 +182,11 @@ func (c *CLIClient) Query(ctx context.Context, req QueryRequest) (<-chan StreamR
 			args = append(args, "--model", c.model)
 		}
 
+		// Per-session instructions
+		if req.SystemPrompt != "" {
+			args = append(args, "--append-system-prompt", req.SystemPrompt)
+		}
+
 		// Add session ID if provided (use --resume to continue existing session)
 		if req.SessionID != "" {
 			args = append(args, "--resume", req.SessionID)
@@ -61,9 +198,6 @@ func (c *CLIClient) Query(ctx context.Context, req QueryRequest) (<-chan StreamR
 			// We'll set it via cmd.Dir instead of a flag
 		}
 
-		// Add the prompt as the last argument
-		args = append(args, req.Prompt)
-
 		log.Printf("[Claude CLI] Executing: claude %v", args)
 
 		// Execute Claude CLI
@@ -72,6 +206,14 @@ func (c *CLIClient) Query(ctx context.Context, req QueryRequest) (<-chan StreamR
 			cmd.Dir = req.Workspace
 		}
 
+		// The prompt goes over stdin so it stays out of the process table
+		// and isn't subject to argv length limits
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			errorChan <- fmt.Errorf("failed to create stdin pipe: %w", err)
+			return
+		}
+
 		stdout, err := cmd.StdoutPipe()
 		if err != nil {
 			errorChan <- fmt.Errorf("failed to create stdout pipe: %w", err)
@@ -89,16 +231,52 @@ func (c *CLIClient) Query(ctx context.Context, req QueryRequest) (<-chan StreamR
 			return
 		}
 
-		// Read stderr in background
+		// Write the prompt. In interactive mode stdin stays open for
+		// permission responses until the result arrives; otherwise closing
+		// it lets the CLI start processing.
+		control := &controlWriter{w: stdin}
+		defer control.close()
+		if interactive {
+			err := control.writeJSON(map[string]interface{}{
+				"type": "user",
+				"message": map[string]interface{}{
+					"role":    "user",
+					"content": req.Prompt,
+				},
+			})
+			if err != nil {
+				log.Printf("Failed to write prompt to claude stdin: %v", err)
+			}
+		} else {
+			go func() {
+				defer control.close()
+				if _, err := io.WriteString(stdin, req.Prompt); err != nil {
+					log.Printf("Failed to write prompt to claude stdin: %v", err)
+				}
+			}()
+		}
+
+		// Read stderr in background, keeping the tail to explain a failed exit
+		var stderrTail []string
+		stderrDone := make(chan struct{})
 		go func() {
+			defer close(stderrDone)
 			scanner := bufio.NewScanner(stderr)
 			for scanner.Scan() {
 				log.Printf("[Claude CLI stderr]: %s", scanner.Text())
+				stderrTail = append(stderrTail, scanner.Text())
+				if len(stderrTail) > stderrTailLines {
+					stderrTail = stderrTail[1:]
+				}
 			}
 		}()
 
 		// Parse stdout for JSON messages
+		sawResult := false
+		// The scanner's limit is the larger of its max and the initial
+		// buffer's capacity, so the buffer may not start out bigger
 		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 0, min(64*1024, c.maxLineSize)), c.maxLineSize)
 		for scanner.Scan() {
 			line := scanner.Text()
 			if line == "" {
@@ -112,27 +290,87 @@ func (c *CLIClient) Query(ctx context.Context, req QueryRequest) (<-chan StreamR
 				continue
 			}
 
+			if interactive {
+				switch cliMessage["type"] {
+				case "control_request":
+					// Answer without blocking the reader; the CLI waits anyway
+					go func(msg map[string]interface{}) {
+						if err := answerControlRequest(ctx, control, msg, req.OnPermission); err != nil {
+							log.Printf("Failed to answer claude control request: %v", err)
+						}
+					}(cliMessage)
+					continue
+				case "control_response", "control_cancel_request":
+					continue
+				case "result":
+					control.close()
+				}
+			}
+
+			if cliMessage["type"] == "result" {
+				sawResult = true
+			}
+
 			// Convert CLI format to our StreamResponse format
 			response := c.convertCLIMessage(cliMessage)
 			if response != nil {
 				select {
-				case responseChan <- *response:
+				case parsed <- *response:
 				case <-ctx.Done():
 					cmd.Process.Kill()
+					cmd.Wait()
 					return
 				}
 			}
 		}
 
-		if err := scanner.Err(); err != nil && err != io.EOF {
+		if err := scanner.Err(); err == bufio.ErrTooLong {
+			// Report it in-stream so it isn't lost behind the done signal
+			cmd.Process.Kill()
+			cmd.Wait()
+			select {
+			case parsed <- StreamResponse{
+				Type:  "error",
+				Error: fmt.Sprintf("Claude output line exceeded %d bytes; response stopped", c.maxLineSize),
+			}:
+			case <-ctx.Done():
+			}
+			return
+		} else if err != nil && err != io.EOF {
 			errorChan <- fmt.Errorf("error reading CLI output: %w", err)
 		}
 
-		cmd.Wait()
+		// Let stderr drain, without hanging on a child that inherited it
+		select {
+		case <-stderrDone:
+		case <-time.After(time.Second):
+		}
+		waitErr := cmd.Wait()
+
+		// A timed out query reports the timeout instead
+		if ctx.Err() != nil {
+			return
+		}
+
+		// A failed exit without a result message would otherwise look like
+		// a silent success
+		var exitErr *exec.ExitError
+		if errors.As(waitErr, &exitErr) && !sawResult {
+			<-stderrDone
+			text := fmt.Sprintf("claude exited with code %d", exitErr.ExitCode())
+			if len(stderrTail) > 0 {
+				text += ":\n" + strings.Join(stderrTail, "\n")
+			}
+			select {
+			case parsed <- StreamResponse{Type: "error", Error: text}:
+			case <-ctx.Done():
+			}
+			return
+		}
 
 		// Send done signal
 		select {
-		case responseChan <- StreamResponse{Type: "done"}:
+		case parsed <- StreamResponse{Type: "done"}:
 		case <-ctx.Done():
 			return
 		}
@@ -166,3 +404,12 @@ func (c *CLIClient) Health(ctx context.Context) error {
 	}
 	return nil
 }
+
+// Version returns the Claude CLI version string
+func (c *CLIClient) Version(ctx context.Context) (string, error) {
+	output, err := exec.CommandContext(ctx, "claude", "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get claude version: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
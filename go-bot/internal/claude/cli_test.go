@@ -0,0 +1,155 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClaude puts a claude executable on PATH that prints output
+func fakeClaude(t *testing.T, output string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	outputPath := filepath.Join(dir, "output.jsonl")
+	if err := os.WriteFile(outputPath, []byte(output), 0600); err != nil {
+		t.Fatal(err)
+	}
+	script := "#!/bin/sh\ncat '" + outputPath + "'\n"
+	if err := os.WriteFile(filepath.Join(dir, "claude"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// collect reads every response of a query until its channels close
+func collect(t *testing.T, client *CLIClient) ([]StreamResponse, error) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	responseChan, errorChan := client.Query(ctx, QueryRequest{Prompt: "hi", Workspace: t.TempDir()})
+	var responses []StreamResponse
+	for response := range responseChan {
+		responses = append(responses, response)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("query did not finish")
+	}
+	return responses, <-errorChan
+}
+
+// messageTypes returns the type of each response, using the CLI message
+// type for claude_message responses
+func messageTypes(t *testing.T, responses []StreamResponse) []string {
+	t.Helper()
+
+	var types []string
+	for _, response := range responses {
+		if response.Type != "claude_message" {
+			types = append(types, response.Type)
+			continue
+		}
+		var msg struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(response.Data, &msg); err != nil {
+			t.Fatalf("invalid claude_message data: %v", err)
+		}
+		types = append(types, msg.Type)
+	}
+	return types
+}
+
+func TestCLIClientQueryLongLine(t *testing.T) {
+	// Far past bufio.Scanner's 64 KiB default
+	text := strings.Repeat("x", 2*1024*1024)
+	fakeClaude(t, `{"type":"system","session_id":"abc"}`+"\n"+
+		`{"type":"assistant","message":{"content":[{"type":"text","text":"`+text+`"}]}}`+"\n"+
+		`{"type":"result","is_error":false}`+"\n")
+
+	responses, err := collect(t, NewCLIClient("", "bypassPermissions"))
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+
+	got := strings.Join(messageTypes(t, responses), ",")
+	if want := "system,assistant,result,done"; got != want {
+		t.Fatalf("responses = %s, want %s", got, want)
+	}
+	if !strings.Contains(string(responses[1].Data), text) {
+		t.Errorf("assistant message lost its %d byte text", len(text))
+	}
+}
+
+func TestCLIClientQueryLineTooLong(t *testing.T) {
+	fakeClaude(t, `{"type":"assistant","text":"`+strings.Repeat("x", 4096)+`"}`+"\n")
+
+	client := NewCLIClient("", "bypassPermissions")
+	client.SetMaxLineSize(1024)
+	responses, err := collect(t, client)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+
+	got := strings.Join(messageTypes(t, responses), ",")
+	if got != "error" || !strings.Contains(responses[0].Error, "exceeded 1024 bytes") {
+		t.Fatalf("responses = %s, want one line-too-long error", got)
+	}
+}
+
+func TestCLIClientQuerySkipsMalformedLines(t *testing.T) {
+	fakeClaude(t, `{"type":"system","session_id":"abc"}`+"\n"+
+		"Warning: not JSON at all\n"+
+		`{"type":"assistant","message":{"content":[`+"\n"+
+		`["not", "an", "object"]`+"\n"+
+		`{"type":"result","is_error":false}`+"\n")
+
+	responses, err := collect(t, NewCLIClient("", "bypassPermissions"))
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+
+	got := strings.Join(messageTypes(t, responses), ",")
+	if want := "system,result,done"; got != want {
+		t.Fatalf("responses = %s, want %s", got, want)
+	}
+}
+
+func TestBufferStreamStopsReadingAtLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	in := make(chan StreamResponse)
+	out := bufferStream(ctx, in, 10)
+	message := StreamResponse{Type: "assistant", Data: []byte(`"xx"`)} // 13 bytes
+
+	// The first message fits in the empty queue even though it's over the
+	// limit; the second must wait for the consumer
+	in <- message
+	select {
+	case in <- message:
+		t.Fatal("queue accepted a message while over its byte limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-out
+	select {
+	case in <- message:
+	case <-time.After(time.Second):
+		t.Fatal("queue stayed full after the consumer caught up")
+	}
+	close(in)
+
+	if got := <-out; got.Type != "assistant" {
+		t.Errorf("second message = %+v", got)
+	}
+	if _, ok := <-out; ok {
+		t.Error("output stayed open after the input closed and drained")
+	}
+}
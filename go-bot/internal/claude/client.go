@@ -10,6 +10,7 @@ import (
 	"log"
 	"net/http"
 	"strings"
+	"time"
 )
 
 // QueryClient is an interface for both HTTP and SDK clients
@@ -18,6 +19,11 @@ type QueryClient interface {
 	Health(ctx context.Context) error
 }
 
+// VersionReporter is implemented by clients that can report the Claude version
+type VersionReporter interface {
+	Version(ctx context.Context) (string, error)
+}
+
 // Client represents a Claude bridge HTTP client
 type Client struct {
 	baseURL    string
@@ -32,6 +38,16 @@ type QueryRequest struct {
 	Workspace       string   `json:"workspace,omitempty"`
 	PermissionMode  string   `json:"permissionMode,omitempty"`
 	AllowedTools    []string `json:"allowedTools,omitempty"`
+	DisallowedTools []string `json:"disallowedTools,omitempty"` // Denied even in bypass mode
+	SystemPrompt    string   `json:"appendSystemPrompt,omitempty"`
+
+	// OnPermission is asked about tool uses the permission mode doesn't
+	// allow. Only the CLI client supports it; nil leaves the CLI's default.
+	OnPermission PermissionHandler `json:"-"`
+
+	// Timeout kills the query after this long (0 = no limit), reported as
+	// an error response with Code "timeout". Only the CLI client supports it.
+	Timeout time.Duration `json:"-"`
 }
 
 // StreamResponse represents a response from Claude
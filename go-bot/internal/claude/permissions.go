@@ -0,0 +1,102 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// PermissionRequest is Claude asking to use a tool that the permission
+// mode doesn't already allow
+type PermissionRequest struct {
+	ToolName string
+	Input    map[string]interface{}
+}
+
+// PermissionHandler decides whether Claude may use a tool. It blocks until
+// a decision is made and should return false if ctx is cancelled.
+type PermissionHandler func(ctx context.Context, req PermissionRequest) bool
+
+// controlWriter serializes JSON lines written to the CLI's stdin, which is
+// shared by the prompt and concurrent permission responses
+type controlWriter struct {
+	w      io.WriteCloser
+	mu     sync.Mutex
+	closed bool
+}
+
+// writeJSON writes v as a single line
+func (cw *controlWriter) writeJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	if cw.closed {
+		return fmt.Errorf("stdin already closed")
+	}
+	_, err = cw.w.Write(data)
+	return err
+}
+
+// close closes stdin, letting the CLI exit once it has finished
+func (cw *controlWriter) close() {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	if !cw.closed {
+		cw.closed = true
+		cw.w.Close()
+	}
+}
+
+// answerControlRequest handles a control_request from the CLI. Tool
+// permission requests are passed to handler; anything else is refused.
+func answerControlRequest(ctx context.Context, w *controlWriter, msg map[string]interface{}, handler PermissionHandler) error {
+	requestID, _ := msg["request_id"].(string)
+	request, _ := msg["request"].(map[string]interface{})
+	subtype, _ := request["subtype"].(string)
+
+	if subtype != "can_use_tool" {
+		return w.writeJSON(map[string]interface{}{
+			"type": "control_response",
+			"response": map[string]interface{}{
+				"subtype":    "error",
+				"request_id": requestID,
+				"error":      fmt.Sprintf("unsupported control request: %s", subtype),
+			},
+		})
+	}
+
+	toolName, _ := request["tool_name"].(string)
+	input, _ := request["input"].(map[string]interface{})
+	if input == nil {
+		input = map[string]interface{}{}
+	}
+
+	decision := map[string]interface{}{
+		"behavior": "deny",
+		"message":  "The user denied permission to use this tool",
+	}
+	if handler(ctx, PermissionRequest{ToolName: toolName, Input: input}) {
+		decision = map[string]interface{}{
+			"behavior":     "allow",
+			"updatedInput": input,
+		}
+	}
+
+	return w.writeJSON(map[string]interface{}{
+		"type": "control_response",
+		"response": map[string]interface{}{
+			"subtype":    "success",
+			"request_id": requestID,
+			"response":   decision,
+		},
+	})
+}
@@ -0,0 +1,209 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drew/omnik-bot/internal/fsutil"
+)
+
+// Job is a prompt that runs periodically in a chat
+type Job struct {
+	ID        int       `json:"id"`
+	ChatID    int64     `json:"chat_id"`
+	UserID    int64     `json:"user_id"`
+	Spec      string    `json:"spec"`
+	Prompt    string    `json:"prompt"`
+	CreatedAt time.Time `json:"created_at"`
+	NextRun   time.Time `json:"next_run"`
+}
+
+// Store manages scheduled jobs and persists them to disk
+type Store struct {
+	jobs      map[int]*Job
+	nextID    int
+	storePath string
+	mu        sync.Mutex
+}
+
+// NewStore creates a job store, loading existing jobs from storePath
+func NewStore(storePath string) (*Store, error) {
+	s := &Store{
+		jobs:      make(map[int]*Job),
+		nextID:    1,
+		storePath: storePath,
+	}
+
+	if err := s.load(); err != nil {
+		// If file doesn't exist, that's okay - we'll create it on first save
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to load schedules: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// ParseInterval parses a schedule spec: @hourly, @daily, @weekly or a Go
+// duration such as 30m or 6h
+func ParseInterval(spec string) (time.Duration, error) {
+	switch strings.ToLower(spec) {
+	case "@hourly":
+		return time.Hour, nil
+	case "@daily":
+		return 24 * time.Hour, nil
+	case "@weekly":
+		return 7 * 24 * time.Hour, nil
+	}
+
+	interval, err := time.ParseDuration(spec)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schedule %q: use @hourly, @daily, @weekly or a duration like 30m", spec)
+	}
+	if interval < time.Minute {
+		return 0, fmt.Errorf("invalid schedule %q: minimum interval is 1m", spec)
+	}
+	return interval, nil
+}
+
+// Add schedules a new job; its first run is one interval from now
+func (s *Store) Add(chatID, userID int64, spec, prompt string) (*Job, error) {
+	interval, err := ParseInterval(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	job := &Job{
+		ID:        s.nextID,
+		ChatID:    chatID,
+		UserID:    userID,
+		Spec:      spec,
+		Prompt:    prompt,
+		CreatedAt: now,
+		NextRun:   now.Add(interval),
+	}
+	s.jobs[job.ID] = job
+	s.nextID++
+
+	if err := s.save(); err != nil {
+		return nil, fmt.Errorf("failed to save schedule: %w", err)
+	}
+
+	copied := *job
+	return &copied, nil
+}
+
+// Remove deletes a job belonging to chatID
+func (s *Store) Remove(chatID int64, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok || job.ChatID != chatID {
+		return fmt.Errorf("schedule not found: %d", id)
+	}
+
+	delete(s.jobs, id)
+	return s.save()
+}
+
+// List returns the jobs for chatID ordered by ID
+func (s *Store) List(chatID int64) []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var jobs []Job
+	for _, job := range s.jobs {
+		if job.ChatID == chatID {
+			jobs = append(jobs, *job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs
+}
+
+// TakeDue returns jobs whose next run is at or before now and advances
+// their next run past now. The due jobs are returned even if saving the
+// advanced schedule fails.
+func (s *Store) TakeDue(now time.Time) ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []Job
+	for _, job := range s.jobs {
+		if job.NextRun.After(now) {
+			continue
+		}
+
+		due = append(due, *job)
+
+		interval, err := ParseInterval(job.Spec)
+		if err != nil {
+			interval = 24 * time.Hour
+		}
+		// Skip missed runs (e.g. while the bot was down) instead of replaying them
+		for !job.NextRun.After(now) {
+			job.NextRun = job.NextRun.Add(interval)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+
+	if len(due) > 0 {
+		if err := s.save(); err != nil {
+			return due, fmt.Errorf("failed to save schedules: %w", err)
+		}
+	}
+	return due, nil
+}
+
+// save persists jobs to disk
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(struct {
+		Jobs   map[int]*Job `json:"jobs"`
+		NextID int          `json:"next_id"`
+	}{
+		Jobs:   s.jobs,
+		NextID: s.nextID,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return fsutil.WriteFileAtomic(s.storePath, data, 0644)
+}
+
+// load loads jobs from disk
+func (s *Store) load() error {
+	data, err := os.ReadFile(s.storePath)
+	if err != nil {
+		return err
+	}
+
+	var stored struct {
+		Jobs   map[int]*Job `json:"jobs"`
+		NextID int          `json:"next_id"`
+	}
+
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+
+	if stored.Jobs != nil {
+		s.jobs = stored.Jobs
+	}
+	if stored.NextID > 0 {
+		s.nextID = stored.NextID
+	}
+
+	return nil
+}
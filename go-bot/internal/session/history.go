@@ -0,0 +1,108 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+)
+
+// maxTranscriptLine is the longest transcript line read; tool results with
+// file contents can be large
+const maxTranscriptLine = 16 * 1024 * 1024
+
+// Message is a user or assistant turn from a session's transcript
+type Message struct {
+	Role      string // "user" or "assistant"
+	Text      string
+	Timestamp time.Time
+}
+
+// transcriptEntry is the part of a transcript line ReadRecentMessages uses
+type transcriptEntry struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Message   struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"message"`
+}
+
+// ReadRecentMessages returns up to the last n user/assistant messages with
+// text from a session's transcript, oldest first. Sessions without a
+// transcript yet return no messages.
+func (m *Manager) ReadRecentMessages(nameOrID string, n int) ([]Message, error) {
+	session, err := m.Get(nameOrID)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := findClaudeSessionFile(session.ID)
+	if err != nil {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var messages []Message
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxTranscriptLine)
+	for scanner.Scan() {
+		var entry transcriptEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if entry.Type != "user" && entry.Type != "assistant" {
+			continue
+		}
+
+		text := contentText(entry.Message.Content)
+		if text == "" {
+			// Tool calls and tool results carry no text
+			continue
+		}
+
+		messages = append(messages, Message{Role: entry.Type, Text: text, Timestamp: entry.Timestamp})
+		if len(messages) > n {
+			messages = messages[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// contentText extracts the text from message content, which is either a
+// plain string or a list of content blocks
+func contentText(content json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return strings.TrimSpace(text)
+	}
+
+	var blocks []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(content, &blocks); err != nil {
+		return ""
+	}
+
+	var parts []string
+	for _, block := range blocks {
+		if block.Type == "text" && strings.TrimSpace(block.Text) != "" {
+			parts = append(parts, strings.TrimSpace(block.Text))
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
@@ -2,28 +2,63 @@ package session
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"os"
+	"path"
+	"sort"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/drew/omnik-bot/internal/fsutil"
 )
 
 // Session represents a Claude Code session with its metadata
 type Session struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	WorkingDir  string    `json:"working_dir"`
-	CreatedAt   time.Time `json:"created_at"`
-	LastUsedAt  time.Time `json:"last_used_at"`
-	Description string    `json:"description,omitempty"`
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	WorkingDir   string    `json:"working_dir"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastUsedAt   time.Time `json:"last_used_at"`
+	Description  string    `json:"description,omitempty"`
+	Tags         []string  `json:"tags,omitempty"`
+	Pinned       bool      `json:"pinned,omitempty"`
+	SystemPrompt string    `json:"system_prompt,omitempty"`  // Appended to Claude's system prompt
+	AllowedTools []string  `json:"allowed_tools,omitempty"`  // Tools Claude may use (empty = default)
+	TotalCostUSD float64   `json:"total_cost_usd,omitempty"` // As reported by Claude's results
+	QueryCount   int       `json:"query_count,omitempty"`
+	InputTokens  int       `json:"input_tokens,omitempty"`
+	OutputTokens int       `json:"output_tokens,omitempty"`
+}
+
+// HasTag reports whether the session is tagged with tag
+func (s *Session) HasTag(tag string) bool {
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
 }
 
-// Manager manages multiple Claude sessions
+// clone returns a copy of the session that callers can read without
+// holding the manager's lock
+func (s *Session) clone() *Session {
+	c := *s
+	c.Tags = append([]string(nil), s.Tags...)
+	c.AllowedTools = append([]string(nil), s.AllowedTools...)
+	return &c
+}
+
+// Manager manages multiple Claude sessions. Sessions returned by its
+// methods are snapshots; use the Manager's methods to modify them.
 type Manager struct {
-	sessions      map[string]*Session
-	currentID     string
-	storePath     string
-	mu            sync.RWMutex
+	sessions  map[string]*Session
+	currentID string
+	storePath string
+	mu        sync.RWMutex
 }
 
 // NewManager creates a new session manager
@@ -35,8 +70,21 @@ func NewManager(storePath string) (*Manager, error) {
 
 	// Load existing sessions from disk
 	if err := m.load(); err != nil {
-		// If file doesn't exist, that's okay - we'll create it on first save
-		if !os.IsNotExist(err) {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case os.IsNotExist(err):
+			// That's okay - we'll create it on first save
+		case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+			// A corrupt index shouldn't keep the bot from starting
+			backup := fmt.Sprintf("%s.%s.bak", storePath, time.Now().Format("20060102-150405"))
+			if renameErr := os.Rename(storePath, backup); renameErr != nil {
+				return nil, fmt.Errorf("failed to back up corrupt sessions file: %w", renameErr)
+			}
+			log.Printf("Warning: sessions file is corrupt (%v); moved to %s and starting empty", err, backup)
+			m.sessions = make(map[string]*Session)
+			m.currentID = ""
+		default:
 			return nil, fmt.Errorf("failed to load sessions: %w", err)
 		}
 	}
@@ -67,7 +115,7 @@ func (m *Manager) Create(name, description, workingDir string) (*Session, error)
 		return nil, fmt.Errorf("failed to save session: %w", err)
 	}
 
-	return session, nil
+	return session.clone(), nil
 }
 
 // List returns all sessions
@@ -77,28 +125,52 @@ func (m *Manager) List() []*Session {
 
 	sessions := make([]*Session, 0, len(m.sessions))
 	for _, s := range m.sessions {
-		sessions = append(sessions, s)
+		sessions = append(sessions, s.clone())
 	}
 	return sessions
 }
 
-// Get returns a session by name or ID
-func (m *Manager) Get(nameOrID string) (*Session, error) {
+// Search returns sessions whose name matches pattern, sorted by name.
+// Patterns containing glob characters (*, ?, [) are matched as globs;
+// anything else matches as a name prefix.
+func (m *Manager) Search(pattern string) ([]*Session, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	if session, ok := m.sessions[nameOrID]; ok {
-		return session, nil
+	isGlob := strings.ContainsAny(pattern, "*?[")
+	if isGlob {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
 	}
 
-	// Try to find by ID
-	for _, session := range m.sessions {
-		if session.ID == nameOrID {
-			return session, nil
+	var matches []*Session
+	for name, s := range m.sessions {
+		var ok bool
+		if isGlob {
+			ok, _ = path.Match(pattern, name)
+		} else {
+			ok = strings.HasPrefix(name, pattern)
+		}
+		if ok {
+			matches = append(matches, s.clone())
 		}
 	}
 
-	return nil, fmt.Errorf("session not found: %s", nameOrID)
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Name < matches[j].Name })
+	return matches, nil
+}
+
+// Get returns a session by name or ID
+func (m *Manager) Get(nameOrID string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, err := m.get(nameOrID)
+	if err != nil {
+		return nil, err
+	}
+	return session.clone(), nil
 }
 
 // Switch switches to a different session
@@ -118,7 +190,7 @@ func (m *Manager) Switch(nameOrID string) (*Session, error) {
 		return nil, fmt.Errorf("failed to save session: %w", err)
 	}
 
-	return session, nil
+	return session.clone(), nil
 }
 
 // Current returns the current session
@@ -126,11 +198,11 @@ func (m *Manager) Current() *Session {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	if m.currentID == "" {
+	session, ok := m.sessions[m.currentID]
+	if !ok {
 		return nil
 	}
-
-	return m.sessions[m.currentID]
+	return session.clone()
 }
 
 // UpdateSessionID updates the session ID (called after Claude SDK assigns one)
@@ -147,22 +219,125 @@ func (m *Manager) UpdateSessionID(name, id string) error {
 	return m.save()
 }
 
-// UpdateWorkingDir updates the working directory for the current session
-func (m *Manager) UpdateWorkingDir(workingDir string) error {
+// UpdateWorkingDir updates the working directory of a session
+func (m *Manager) UpdateWorkingDir(nameOrID, workingDir string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if m.currentID == "" {
-		return fmt.Errorf("no current session")
+	session, err := m.get(nameOrID)
+	if err != nil {
+		return err
 	}
-
-	session := m.sessions[m.currentID]
 	session.WorkingDir = workingDir
 	session.LastUsedAt = time.Now()
 
 	return m.save()
 }
 
+// AddTag tags a session. Adding an existing tag is a no-op.
+func (m *Manager) AddTag(nameOrID, tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, err := m.get(nameOrID)
+	if err != nil {
+		return err
+	}
+
+	if session.HasTag(tag) {
+		return nil
+	}
+	session.Tags = append(session.Tags, tag)
+
+	return m.save()
+}
+
+// RemoveTag removes a tag from a session
+func (m *Manager) RemoveTag(nameOrID, tag string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, err := m.get(nameOrID)
+	if err != nil {
+		return err
+	}
+
+	if !session.HasTag(tag) {
+		return fmt.Errorf("session %s is not tagged %s", session.Name, tag)
+	}
+
+	tags := make([]string, 0, len(session.Tags)-1)
+	for _, t := range session.Tags {
+		if t != tag {
+			tags = append(tags, t)
+		}
+	}
+	session.Tags = tags
+
+	return m.save()
+}
+
+// SetPinned pins or unpins a session
+func (m *Manager) SetPinned(nameOrID string, pinned bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, err := m.get(nameOrID)
+	if err != nil {
+		return err
+	}
+
+	session.Pinned = pinned
+	return m.save()
+}
+
+// SetSystemPrompt sets the instructions appended to Claude's system prompt
+// for a session; an empty prompt clears them
+func (m *Manager) SetSystemPrompt(nameOrID, prompt string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, err := m.get(nameOrID)
+	if err != nil {
+		return err
+	}
+
+	session.SystemPrompt = prompt
+	return m.save()
+}
+
+// SetAllowedTools restricts the tools Claude may use in a session; an
+// empty list restores the default tools
+func (m *Manager) SetAllowedTools(nameOrID string, tools []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, err := m.get(nameOrID)
+	if err != nil {
+		return err
+	}
+
+	session.AllowedTools = tools
+	return m.save()
+}
+
+// RecordUsage adds a completed query, its cost and tokens to a session's totals
+func (m *Manager) RecordUsage(nameOrID string, costUSD float64, inputTokens, outputTokens int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, err := m.get(nameOrID)
+	if err != nil {
+		return err
+	}
+
+	session.QueryCount++
+	session.TotalCostUSD += costUSD
+	session.InputTokens += inputTokens
+	session.OutputTokens += outputTokens
+	return m.save()
+}
+
 // Delete deletes a session
 func (m *Manager) Delete(nameOrID string) error {
 	m.mu.Lock()
@@ -210,20 +385,78 @@ func (m *Manager) get(nameOrID string) (*Session, error) {
 	return nil, fmt.Errorf("session not found: %s", nameOrID)
 }
 
-// save persists sessions to disk
-func (m *Manager) save() error {
-	data, err := json.MarshalIndent(struct {
-		Sessions  map[string]*Session `json:"sessions"`
-		CurrentID string              `json:"current_id"`
-	}{
+// Export returns the session index in the same format it is stored on disk
+func (m *Manager) Export() ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.marshal()
+}
+
+// Import loads a session index produced by Export. With replace, the
+// existing sessions are discarded; otherwise imported sessions are merged
+// in, overwriting any with the same name. Returns the number imported.
+func (m *Manager) Import(data []byte, replace bool) (int, error) {
+	var stored storeData
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return 0, fmt.Errorf("invalid session index: %w", err)
+	}
+	if stored.Sessions == nil {
+		return 0, fmt.Errorf("invalid session index: no sessions field")
+	}
+	for key, s := range stored.Sessions {
+		if s == nil || s.Name == "" {
+			return 0, fmt.Errorf("invalid session index: session %q has no name", key)
+		}
+		if s.Name != key {
+			return 0, fmt.Errorf("invalid session index: session %q is stored under %q", s.Name, key)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if replace {
+		m.sessions = stored.Sessions
+		m.currentID = ""
+		if _, ok := m.sessions[stored.CurrentID]; ok {
+			m.currentID = stored.CurrentID
+		}
+	} else {
+		for key, s := range stored.Sessions {
+			m.sessions[key] = s
+		}
+	}
+
+	if err := m.save(); err != nil {
+		return 0, fmt.Errorf("failed to save sessions: %w", err)
+	}
+
+	return len(stored.Sessions), nil
+}
+
+// storeData is the on-disk layout of the session index
+type storeData struct {
+	Sessions  map[string]*Session `json:"sessions"`
+	CurrentID string              `json:"current_id"`
+}
+
+// marshal (internal, no lock) encodes the session index
+func (m *Manager) marshal() ([]byte, error) {
+	return json.MarshalIndent(storeData{
 		Sessions:  m.sessions,
 		CurrentID: m.currentID,
 	}, "", "  ")
+}
+
+// save persists sessions to disk
+func (m *Manager) save() error {
+	data, err := m.marshal()
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(m.storePath, data, 0644)
+	return fsutil.WriteFileAtomic(m.storePath, data, 0644)
 }
 
 // load loads sessions from disk
@@ -233,16 +466,15 @@ func (m *Manager) load() error {
 		return err
 	}
 
-	var stored struct {
-		Sessions  map[string]*Session `json:"sessions"`
-		CurrentID string              `json:"current_id"`
-	}
-
+	var stored storeData
 	if err := json.Unmarshal(data, &stored); err != nil {
 		return err
 	}
 
 	m.sessions = stored.Sessions
+	if m.sessions == nil {
+		m.sessions = make(map[string]*Session)
+	}
 	m.currentID = stored.CurrentID
 
 	return nil
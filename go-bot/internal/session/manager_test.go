@@ -0,0 +1,121 @@
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// TestManagerConcurrentAccess hits a Manager from many goroutines at once;
+// run it with -race to catch unsynchronized access
+func TestManagerConcurrentAccess(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManager(filepath.Join(dir, "sessions.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Create("shared", "", dir); err != nil {
+		t.Fatal(err)
+	}
+
+	const workers = 8
+	const rounds = 20
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			name := fmt.Sprintf("worker-%d", w)
+			if _, err := m.Create(name, "", dir); err != nil {
+				t.Error(err)
+				return
+			}
+
+			for i := 0; i < rounds; i++ {
+				if err := m.RecordUsage("shared", 0.01, 10, 5); err != nil {
+					t.Error(err)
+				}
+				if err := m.AddTag(name, fmt.Sprintf("t%d", i%3)); err != nil {
+					t.Error(err)
+				}
+				if _, err := m.Switch(name); err != nil {
+					t.Error(err)
+				}
+				if s := m.Current(); s != nil {
+					s.Tags = append(s.Tags, "snapshot-only")
+				}
+				for _, s := range m.List() {
+					_ = s.HasTag("t1")
+				}
+				if _, err := m.Get("shared"); err != nil {
+					t.Error(err)
+				}
+				if _, err := m.Search("worker-*"); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	shared, err := m.Get("shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := workers * rounds; shared.QueryCount != want {
+		t.Errorf("QueryCount = %d, want %d", shared.QueryCount, want)
+	}
+	if got := len(m.List()); got != workers+1 {
+		t.Errorf("List returned %d sessions, want %d", got, workers+1)
+	}
+	for _, s := range m.List() {
+		if s.HasTag("snapshot-only") {
+			t.Errorf("session %s was modified through a snapshot", s.Name)
+		}
+	}
+}
+
+func TestNewManagerRecoversFromCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+	storePath := filepath.Join(dir, "sessions.json")
+	corrupt := []byte(`{"sessions": {"broken": {"name": `)
+	if err := os.WriteFile(storePath, corrupt, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManager(storePath)
+	if err != nil {
+		t.Fatalf("NewManager failed on a corrupt file: %v", err)
+	}
+	if got := len(m.List()); got != 0 {
+		t.Errorf("List returned %d sessions, want an empty index", got)
+	}
+
+	backups, err := filepath.Glob(storePath + ".*.bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("found %d backups, want 1", len(backups))
+	}
+	if data, err := os.ReadFile(backups[0]); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(data, corrupt) {
+		t.Errorf("backup holds %q, want the original %q", data, corrupt)
+	}
+
+	if _, err := m.Create("fresh", "", dir); err != nil {
+		t.Fatalf("Create after recovery failed: %v", err)
+	}
+	reloaded, err := NewManager(storePath)
+	if err != nil {
+		t.Fatalf("reloading the saved index failed: %v", err)
+	}
+	if _, err := reloaded.Get("fresh"); err != nil {
+		t.Errorf("session created after recovery was not saved: %v", err)
+	}
+}
@@ -0,0 +1,284 @@
+package session
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// claudeProjectsDir returns the directory where Claude CLI stores transcripts
+func claudeProjectsDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "/home/node"
+	}
+	return filepath.Join(home, ".claude", "projects")
+}
+
+// findClaudeSessionFile locates the Claude CLI transcript (.jsonl) for a session ID
+func findClaudeSessionFile(sessionID string) (string, error) {
+	if sessionID == "" {
+		return "", fmt.Errorf("session has no Claude ID yet")
+	}
+
+	// Transcripts live in one subdirectory per project path
+	matches, err := filepath.Glob(filepath.Join(claudeProjectsDir(), "*", sessionID+".jsonl"))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", os.ErrNotExist
+	}
+
+	return matches[0], nil
+}
+
+// TranscriptPath returns the path of a session's Claude transcript
+func (m *Manager) TranscriptPath(nameOrID string) (string, error) {
+	session, err := m.Get(nameOrID)
+	if err != nil {
+		return "", err
+	}
+	return findClaudeSessionFile(session.ID)
+}
+
+// GetSessionSize returns the size in bytes of a session's Claude transcript.
+// Sessions without a transcript yet report zero.
+func (m *Manager) GetSessionSize(nameOrID string) (int64, error) {
+	session, err := m.Get(nameOrID)
+	if err != nil {
+		return 0, err
+	}
+
+	path, err := findClaudeSessionFile(session.ID)
+	if err != nil {
+		return 0, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat transcript: %w", err)
+	}
+
+	return info.Size(), nil
+}
+
+// ShouldReload reports whether a session's transcript has grown past
+// maxBytes and should be archived in favour of a fresh conversation
+func (m *Manager) ShouldReload(nameOrID string, maxBytes int64) (bool, error) {
+	size, err := m.GetSessionSize(nameOrID)
+	if err != nil {
+		return false, err
+	}
+	return size > maxBytes, nil
+}
+
+// archiveDir returns the directory where archived transcripts are kept
+func (m *Manager) archiveDir() string {
+	return filepath.Join(filepath.Dir(m.storePath), ".omnik-archives")
+}
+
+// Clear archives a session's Claude transcript, removes it and resets the
+// session ID so the next query starts a fresh conversation in the same
+// directory. Returns the archive path, or "" if there was no transcript.
+// The transcript is archived without holding the lock, so other sessions
+// stay usable meanwhile, and only removed once the reset is saved.
+func (m *Manager) Clear(nameOrID string) (string, error) {
+	name, id, err := m.nameAndID(nameOrID)
+	if err != nil {
+		return "", err
+	}
+
+	var archivePath string
+	transcript, findErr := findClaudeSessionFile(id)
+	if findErr == nil {
+		archivePath, err = m.archiveTranscript(name, transcript)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if err := m.resetID(name, id); err != nil {
+		// Nothing was cleared, so the archive copy isn't needed
+		if archivePath != "" {
+			os.Remove(archivePath)
+		}
+		return "", err
+	}
+
+	if findErr == nil {
+		if err := os.Remove(transcript); err != nil {
+			return "", fmt.Errorf("failed to remove transcript: %w", err)
+		}
+	}
+	return archivePath, nil
+}
+
+// resetID clears a session's Claude session ID, provided it is still id
+func (m *Manager) resetID(name, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, err := m.get(name)
+	if err != nil {
+		return err
+	}
+	if session.ID != id {
+		return fmt.Errorf("session %s changed while it was being cleared", name)
+	}
+	session.ID = ""
+	session.LastUsedAt = time.Now()
+
+	if err := m.save(); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+// Archive copies a session's Claude transcript into the archive directory.
+// Returns the archive path, or "" if the session has no transcript.
+func (m *Manager) Archive(nameOrID string) (string, error) {
+	name, id, err := m.nameAndID(nameOrID)
+	if err != nil {
+		return "", err
+	}
+
+	transcript, err := findClaudeSessionFile(id)
+	if err != nil {
+		return "", nil
+	}
+	return m.archiveTranscript(name, transcript)
+}
+
+// nameAndID returns a session's name and Claude session ID
+func (m *Manager) nameAndID(nameOrID string) (string, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, err := m.get(nameOrID)
+	if err != nil {
+		return "", "", err
+	}
+	return session.Name, session.ID, nil
+}
+
+// archiveTranscript copies a transcript, gzip-compressed, into the archive
+// directory
+func (m *Manager) archiveTranscript(name, transcript string) (string, error) {
+	if err := os.MkdirAll(m.archiveDir(), 0755); err != nil {
+		return "", fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	archivePath := filepath.Join(m.archiveDir(), fmt.Sprintf("%s-%s.jsonl.gz", name, time.Now().Format("20060102-150405")))
+	if err := copyAndCompress(transcript, archivePath); err != nil {
+		return "", fmt.Errorf("failed to archive transcript: %w", err)
+	}
+
+	return archivePath, nil
+}
+
+// Fork creates a session named newName that continues the source session's
+// Claude conversation from its current point. The transcript is copied
+// under a new Claude session ID so the two can diverge. The fork becomes
+// the current session.
+func (m *Manager) Fork(nameOrID, newName string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	source, err := m.get(nameOrID)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := m.sessions[newName]; exists {
+		return nil, fmt.Errorf("session already exists: %s", newName)
+	}
+
+	transcript, err := findClaudeSessionFile(source.ID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("session %s has no transcript to fork", source.Name)
+		}
+		return nil, err
+	}
+
+	newID, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries record their session ID, so point the copy at the new one
+	data, err := os.ReadFile(transcript)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcript: %w", err)
+	}
+	data = bytes.ReplaceAll(data, []byte(source.ID), []byte(newID))
+	forkPath := filepath.Join(filepath.Dir(transcript), newID+".jsonl")
+	if err := os.WriteFile(forkPath, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write forked transcript: %w", err)
+	}
+
+	now := time.Now()
+	fork := &Session{
+		ID:           newID,
+		Name:         newName,
+		WorkingDir:   source.WorkingDir,
+		CreatedAt:    now,
+		LastUsedAt:   now,
+		Description:  fmt.Sprintf("Fork of %s", source.Name),
+		Tags:         append([]string(nil), source.Tags...),
+		SystemPrompt: source.SystemPrompt,
+		AllowedTools: append([]string(nil), source.AllowedTools...),
+	}
+	m.sessions[newName] = fork
+	m.currentID = newName
+
+	if err := m.save(); err != nil {
+		return nil, fmt.Errorf("failed to save session: %w", err)
+	}
+
+	return fork.clone(), nil
+}
+
+// newSessionID returns a random UUID in the format Claude uses for session IDs
+func newSessionID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// copyAndCompress gzips src into dst, creating or truncating dst.
+// Transcripts are repetitive JSON and compress well.
+func copyAndCompress(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,92 @@
+package session
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newClearTestManager returns a Manager with one session, "work", whose
+// Claude session ID is id, with HOME pointed at a temporary directory
+func newClearTestManager(t *testing.T, id string) (*Manager, string) {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	dir := t.TempDir()
+	m, err := NewManager(filepath.Join(dir, "sessions.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Create("work", "", dir); err != nil {
+		t.Fatal(err)
+	}
+	if id != "" {
+		if err := m.UpdateSessionID("work", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m, home
+}
+
+func TestClearArchivesTranscript(t *testing.T) {
+	m, home := newClearTestManager(t, "abc-123")
+
+	transcript := filepath.Join(home, ".claude", "projects", "-workspace-work", "abc-123.jsonl")
+	if err := os.MkdirAll(filepath.Dir(transcript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := `{"type":"user"}` + "\n"
+	if err := os.WriteFile(transcript, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath, err := m.Clear("work")
+	if err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatalf("archive missing: %v", err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(gz); err != nil {
+		t.Fatal(err)
+	} else if string(data) != content {
+		t.Errorf("archive holds %q, want %q", data, content)
+	}
+
+	if _, err := os.Stat(transcript); !os.IsNotExist(err) {
+		t.Errorf("transcript still exists after Clear: %v", err)
+	}
+	if s, err := m.Get("work"); err != nil {
+		t.Fatal(err)
+	} else if s.ID != "" {
+		t.Errorf("session ID = %q after Clear, want empty", s.ID)
+	}
+}
+
+func TestClearWithoutTranscript(t *testing.T) {
+	m, _ := newClearTestManager(t, "missing-id")
+
+	archivePath, err := m.Clear("work")
+	if err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if archivePath != "" {
+		t.Errorf("archive path = %q, want none", archivePath)
+	}
+	if s, err := m.Get("work"); err != nil {
+		t.Fatal(err)
+	} else if s.ID != "" {
+		t.Errorf("session ID = %q after Clear, want empty", s.ID)
+	}
+}
@@ -0,0 +1,20 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Build information, injected at build time via:
+//
+//	go build -ldflags "-X github.com/drew/omnik-bot/internal/version.Version=1.2.3 ..."
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// String returns a one-line summary of the build
+func String() string {
+	return fmt.Sprintf("%s (commit %s, built %s, %s)", Version, Commit, BuildDate, runtime.Version())
+}